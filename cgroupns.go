@@ -0,0 +1,245 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// InCgroupNamespace reports whether the calling process is in a different
+// cgroup namespace than init of its pid namespace. Kernels without cgroup
+// namespaces are reported as not being in one.
+func InCgroupNamespace() (bool, error) {
+	var self, init unix.Stat_t
+	if err := unix.Stat("/proc/self/ns/cgroup", &self); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, &os.PathError{Op: "stat", Path: "/proc/self/ns/cgroup", Err: err}
+	}
+	if err := unix.Stat("/proc/1/ns/cgroup", &init); err != nil {
+		return false, &os.PathError{Op: "stat", Path: "/proc/1/ns/cgroup", Err: err}
+	}
+	return self.Dev != init.Dev || self.Ino != init.Ino, nil
+}
+
+// NamespaceCgroupPath translates cgroup, a path relative to the root of its
+// hierarchy, into the path seen in a cgroup namespace rooted at nsRoot. Like
+// the kernel does, cgroups outside of the namespace are shown relative to its
+// root, e.g. "/../sibling".
+func NamespaceCgroupPath(nsRoot, cgroup string) (string, error) {
+	rel, err := filepath.Rel(CleanPath("/"+nsRoot), CleanPath("/"+cgroup))
+	if err != nil {
+		return "", err
+	}
+	if rel == "." {
+		return "/", nil
+	}
+	return "/" + rel, nil
+}
+
+// HostCgroupPath translates cgroup, a path as seen in a cgroup namespace
+// rooted at nsRoot, into the path relative to the root of its hierarchy.
+func HostCgroupPath(nsRoot, cgroup string) string {
+	return filepath.Join("/", nsRoot, cgroup)
+}
+
+// mountedCgroupPath returns the directory of cgroup, as read from a
+// /proc/<pid>/cgroup file, in the hierarchy mounted at mnt with root as its
+// root in mountinfo.
+//
+// Both cgroup and root are relative to the root of our cgroup namespace. If
+// the hierarchy was mounted outside of the namespace, its root is above the
+// namespace root, and shows up as "/.." in mountinfo, which does not tell
+// which directory under mnt the namespace root is. The cgroup is then looked
+// up in another mount of the same hierarchy, made inside the namespace.
+func mountedCgroupPath(mnt, root, cgroup string) (string, error) {
+	up, ok := namespaceDepth(root)
+	if !ok {
+		return "", NewNotFoundError(mnt)
+	}
+	if up == 0 {
+		// This is needed for nested containers, because in /proc/self/cgroup
+		// we see paths from host, which don't exist in container.
+		rel, err := filepath.Rel(root, cgroup)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(mnt, rel), nil
+	}
+
+	snap, err := getMountSnapshot()
+	if err != nil {
+		return "", err
+	}
+	return findNamespaceMountPath(snap.mountinfo, mnt, cgroup)
+}
+
+// findNamespaceMountPath returns the directory of cgroup in a mount of the
+// hierarchy mounted at mnt whose root is inside our cgroup namespace.
+func findNamespaceMountPath(mountinfo []byte, mnt, cgroup string) (string, error) {
+	m, err := findMount(mountinfo, mnt)
+	if err != nil {
+		return "", err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(mountinfo))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), " ")
+		if len(fields) < 5 || fields[2] != m.dev {
+			continue
+		}
+		if up, ok := namespaceDepth(fields[3]); !ok || up != 0 {
+			continue
+		}
+		rel, err := filepath.Rel(fields[3], cgroup)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			continue
+		}
+		return filepath.Join(fields[4], rel), nil
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", NewNotFoundError(mnt)
+}
+
+// namespaceDepth returns how many levels the mount root is above the root of
+// our cgroup namespace. Roots that are neither below nor directly above it,
+// e.g. "/../sibling", are not supported.
+func namespaceDepth(root string) (int, bool) {
+	if !strings.HasPrefix(root, "/..") {
+		return 0, true
+	}
+	up := 0
+	for _, elem := range strings.Split(strings.TrimPrefix(root, "/"), "/") {
+		if elem != ".." {
+			return 0, false
+		}
+		up++
+	}
+	return up, true
+}
+
+// StartInCgroupNamespace starts cmd inside the manager's cgroups, like
+// StartInCgroup, and in a new cgroup namespace rooted at them, so that the
+// child sees its cgroups as "/".
+//
+// The namespace is rooted at the cgroups the child is in when it unshares
+// it, so the child must be created in them. On cgroup v2 this is done with
+// CLONE_INTO_CGROUP. For the v1 hierarchies, the child is started from a
+// thread that is moved into the manager's cgroups for the time of the fork.
+// As the parent death signal is tied to the thread that started the child,
+// which keeps running other goroutines afterwards, cmd.SysProcAttr.Pdeathsig
+// is not supported. Neither is a frozen v1 freezer cgroup, which would
+// freeze that thread.
+func (m *manager) StartInCgroupNamespace(cmd *exec.Cmd) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	if cmd.SysProcAttr.Pdeathsig != 0 {
+		return errors.New("cgroup: Pdeathsig is not supported with a new cgroup namespace")
+	}
+
+	paths := m.GetPaths()
+	var unified string
+	for _, path := range paths {
+		if isCgroup2Dir(path) {
+			unified = path
+			break
+		}
+	}
+	if unified != "" {
+		if !cloneIntoCgroupSupported() {
+			return errors.New("cgroup: a new cgroup namespace on cgroup v2 requires CLONE_INTO_CGROUP")
+		}
+		fd, err := unix.Open(unified, unix.O_DIRECTORY|unix.O_RDONLY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return &os.PathError{Op: "open", Path: unified, Err: err}
+		}
+		defer unix.Close(fd)
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = fd
+	}
+	if freezer := paths["freezer"]; freezer != "" && freezer != unified && PathExists(freezer) {
+		state, err := m.GetFreezerState()
+		if err != nil {
+			return err
+		}
+		if state != Thawed {
+			return fmt.Errorf("cgroup: cannot start a process in %s, it is %s", freezer, state)
+		}
+	}
+	cmd.SysProcAttr.Unshareflags |= unix.CLONE_NEWCGROUP
+
+	errCh := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		tid := unix.Gettid()
+		orig, err := threadCgroupPaths(paths, unified)
+		if err != nil {
+			runtime.UnlockOSThread()
+			errCh <- err
+			return
+		}
+		moved := make(map[string]string)
+		for name, path := range paths {
+			if path == unified || !PathExists(path) {
+				continue
+			}
+			if err = WriteCgroupThread(path, tid); err != nil {
+				break
+			}
+			moved[name] = orig[name]
+		}
+		if err == nil {
+			err = cmd.Start()
+		}
+		for _, path := range moved {
+			if rerr := WriteCgroupThread(path, tid); rerr != nil {
+				// Never unlock the thread, so that it exits with the
+				// goroutine rather than running others in our cgroups.
+				logrus.Warnf("unable to move thread %d back to %s: %v", tid, path, rerr)
+				errCh <- err
+				return
+			}
+		}
+		runtime.UnlockOSThread()
+		errCh <- err
+	}()
+	return <-errCh
+}
+
+// threadCgroupPaths returns the directories of the calling thread's cgroups
+// in the hierarchies of paths, except for unified.
+func threadCgroupPaths(paths map[string]string, unified string) (map[string]string, error) {
+	cgroups, err := ParseCgroupFile("/proc/thread-self/cgroup")
+	if err != nil {
+		return nil, err
+	}
+	orig := make(map[string]string)
+	for name, path := range paths {
+		if path == unified || !PathExists(path) {
+			continue
+		}
+		cgroup, err := getControllerPath(name, cgroups)
+		if err != nil {
+			return nil, err
+		}
+		if orig[name], err = getCgroupPathHelper("", name, cgroup); err != nil {
+			return nil, err
+		}
+	}
+	return orig, nil
+}
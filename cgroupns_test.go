@@ -0,0 +1,164 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestNamespaceCgroupPath(t *testing.T) {
+	testCases := []struct {
+		nsRoot, cgroup, expected string
+	}{
+		{"/a", "/a/b", "/b"},
+		{"/a", "/a", "/"},
+		{"/", "/a/b", "/a/b"},
+		{"/a/b", "/a/c", "/../c"},
+		{"/a/b", "/", "/../.."},
+	}
+	for _, tc := range testCases {
+		got, err := NamespaceCgroupPath(tc.nsRoot, tc.cgroup)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.expected {
+			t.Errorf("NamespaceCgroupPath(%q, %q): expected %q, got %q", tc.nsRoot, tc.cgroup, tc.expected, got)
+		}
+		if host := HostCgroupPath(tc.nsRoot, got); host != tc.cgroup {
+			t.Errorf("HostCgroupPath(%q, %q): expected %q, got %q", tc.nsRoot, got, tc.cgroup, host)
+		}
+	}
+}
+
+func TestNamespaceDepth(t *testing.T) {
+	testCases := []struct {
+		root string
+		up   int
+		ok   bool
+	}{
+		{"/", 0, true},
+		{"/docker/abc", 0, true},
+		{"/..", 1, true},
+		{"/../..", 2, true},
+		{"/../sibling", 0, false},
+	}
+	for _, tc := range testCases {
+		up, ok := namespaceDepth(tc.root)
+		if up != tc.up || ok != tc.ok {
+			t.Errorf("namespaceDepth(%q): expected %d, %v, got %d, %v", tc.root, tc.up, tc.ok, up, ok)
+		}
+	}
+}
+
+func TestFindNamespaceMountPath(t *testing.T) {
+	mountinfo := []byte(`36 25 0:31 /.. /sys/fs/cgroup/cpu rw,nosuid shared:9 - cgroup cgroup rw,cpu
+37 25 0:32 /.. /sys/fs/cgroup/memory rw,nosuid shared:10 - cgroup cgroup rw,memory
+48 36 0:31 / /mnt/cpu rw,nosuid - cgroup cgroup rw,cpu
+`)
+	got, err := findNamespaceMountPath(mountinfo, "/sys/fs/cgroup/cpu", "/a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "/mnt/cpu/a/b" {
+		t.Errorf("Expected /mnt/cpu/a/b, got %q", got)
+	}
+	if _, err := findNamespaceMountPath(mountinfo, "/sys/fs/cgroup/memory", "/a"); !IsNotFound(err) {
+		t.Errorf("Expected a not found error without a mount inside the namespace, got %v", err)
+	}
+}
+
+func TestStartInCgroupNamespace(t *testing.T) {
+	if IsCgroup2UnifiedMode() {
+		t.Skip("cgroup v1 only")
+	}
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	if _, err := os.Stat("/proc/self/ns/cgroup"); err != nil {
+		t.Skip(err)
+	}
+
+	config := &CgroupConfig{
+		Path:      fmt.Sprintf("/test-cgroupns-%d", time.Now().Nanosecond()),
+		Resources: &Resources{},
+	}
+	m := NewManager(config, nil, false)
+	defer m.Close()
+	if err := m.Apply(-1); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Destroy()
+
+	var out bytes.Buffer
+	cmd := exec.Command("cat", "/proc/self/cgroup")
+	cmd.Stdout = &out
+	if err := m.StartInCgroupNamespace(cmd); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	cgroups, err := parseCgroupFromReader(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name := range m.GetPaths() {
+		if name == UnifiedHierarchy {
+			name = ""
+		}
+		if got := cgroups[name]; got != "/" {
+			t.Errorf("Expected %q cgroup to be the namespace root, got %q", name, got)
+		}
+	}
+}
+
+func TestStartInCgroupNamespaceFrozen(t *testing.T) {
+	if IsCgroup2UnifiedMode() {
+		t.Skip("cgroup v1 only")
+	}
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	if _, err := os.Stat("/proc/self/ns/cgroup"); err != nil {
+		t.Skip(err)
+	}
+
+	config := &CgroupConfig{
+		Path:      fmt.Sprintf("/test-cgroupns-frozen-%d", time.Now().Nanosecond()),
+		Resources: &Resources{},
+	}
+	m := NewManager(config, nil, false)
+	defer m.Close()
+	if err := m.Apply(-1); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Destroy()
+	if m.Path("freezer") == "" {
+		t.Skip("no freezer cgroup")
+	}
+	if err := m.Freeze(Frozen); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Freeze(Thawed)
+
+	cmd := exec.Command("true")
+	if err := m.StartInCgroupNamespace(cmd); err == nil {
+		cmd.Wait()
+		t.Fatal("Expected starting a process in a frozen cgroup to fail")
+	}
+}
+
+func TestInCgroupNamespace(t *testing.T) {
+	in, err := InCgroupNamespace()
+	if err != nil {
+		// /proc/1 is not always accessible, e.g. without CAP_SYS_PTRACE.
+		t.Skip(err)
+	}
+	t.Logf("in cgroup namespace: %v", in)
+}
@@ -2,17 +2,44 @@
 
 package cgroupManager
 
+import (
+	"context"
+	"os/exec"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
 type Manager interface {
 	Apply(pid int) error
+	ApplyPidfd(pidfd int) error
+	StartInCgroup(cmd *exec.Cmd) error
+	StartInCgroupNamespace(cmd *exec.Cmd) error
 	GetPids() ([]int, error)
 	GetAllPids() ([]int, error)
+	AddThread(tid int) error
+	GetThreads() ([]int, error)
+	Signal(sig unix.Signal, recursive bool) error
 	GetStats() (*Stats, error)
+	NewStatsReader() *StatsReader
+	GetLiveResources() (*Resources, error)
 	Freeze(state FreezerState) error
+	FreezeContext(ctx context.Context, state FreezerState, revert bool) error
+	PauseFor(d time.Duration) (*PauseLease, error)
 	Destroy() error
+	Delegate(uid, gid int) error
+	DestroyWithKill() error
 	Path(string) string
 	Set(container *Config) error
+	SetTransactional(container *Config) error
+	SetDiff(container *Config) ([]FileChange, error)
+	GetParam(controller, file string) (string, error)
+	SetParam(controller, file, value string) error
+	ClearParam(controller, file string) error
 	GetPaths() map[string]string
 	GetCgroups() (*CgroupConfig, error)
 	GetFreezerState() (FreezerState, error)
+	GetFreezerSubtree() ([]FreezerInfo, error)
 	Exists() bool
+	Close() error
 }
@@ -3,7 +3,10 @@
 package cgroupManager
 
 import (
+	"path/filepath"
 	"testing"
+
+	"golang.org/x/sys/unix"
 )
 
 func TestParseCgroups(t *testing.T) {
@@ -18,3 +21,23 @@ func TestParseCgroups(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestWriteCgroupThread(t *testing.T) {
+	helper := NewCgroupTestUtil("cpuset", t)
+	defer helper.cleanup()
+
+	tid := unix.Gettid()
+	if err := WriteCgroupThread(helper.CgroupPath, tid); err != nil {
+		t.Fatal(err)
+	}
+	if !PathExists(filepath.Join(helper.CgroupPath, CgroupTasks)) {
+		t.Fatalf("Expected thread to be written to %s", CgroupTasks)
+	}
+	tids, err := GetThreads(helper.CgroupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tids) != 1 || tids[0] != tid {
+		t.Errorf("Expected threads [%d], got %v", tid, tids)
+	}
+}
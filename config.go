@@ -6,6 +6,7 @@ const (
 	Undefined FreezerState = ""
 	Frozen    FreezerState = "FROZEN"
 	Thawed    FreezerState = "THAWED"
+	Freezing  FreezerState = "FREEZING"
 )
 
 type CgroupConfig struct {
@@ -14,9 +15,28 @@ type CgroupConfig struct {
 	Path        string            `json:"path,omitempty"`
 	ScopePrefix string            `json:"scope_prefix,omitempty"`
 	Paths       map[string]string `json:"paths,omitempty"`
+	// Subsystems selects the registered subsystems, see Register, that
+	// take part in the cgroup besides the built-in ones. It can not be
+	// combined with Controllers.
+	Subsystems []string `json:"subsystems,omitempty"`
+	// Controllers, if set, lists the only controllers, built-in or
+	// registered, the cgroup joins, instead of all the available ones.
+	// The cgroup v2 hierarchy of a hybrid host is selected as "unified".
+	Controllers []Controller `json:"controllers,omitempty"`
+	// ParamAllowlist lists, per controller, the files GetParam and
+	// SetParam may access. DefaultParamAllowlist is used if it is nil.
+	ParamAllowlist map[string][]string `json:"param_allowlist,omitempty"`
 	*Resources
 }
 
+// Controller is a controller, built-in or registered, a cgroup joins.
+type Controller struct {
+	Name string `json:"name"`
+	// Required makes Apply fail if the controller is not available,
+	// rather than skip it.
+	Required bool `json:"required,omitempty"`
+}
+
 type Resources struct {
 	CpuShares    uint64       `json:"cpu_shares"`
 	CpuQuota     int64        `json:"cpu_quota"`
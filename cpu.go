@@ -60,13 +60,17 @@ func (s *CpuGroup) AddPid(path string, pid int) error {
 }
 
 func (s *CpuGroup) SetRtSched(path string, cgroup *CgroupConfig) error {
+	return s.setRtSched(pathDir(path), cgroup)
+}
+
+func (s *CpuGroup) setRtSched(d *cgroupDir, cgroup *CgroupConfig) error {
 	if cgroup.Resources.CpuRtPeriod != 0 {
-		if err := WriteFile(path, "cpu.rt_period_us", strconv.FormatUint(cgroup.Resources.CpuRtPeriod, 10)); err != nil {
+		if err := d.writeFile("cpu.rt_period_us", strconv.FormatUint(cgroup.Resources.CpuRtPeriod, 10)); err != nil {
 			return err
 		}
 	}
 	if cgroup.Resources.CpuRtRuntime != 0 {
-		if err := WriteFile(path, "cpu.rt_runtime_us", strconv.FormatInt(cgroup.Resources.CpuRtRuntime, 10)); err != nil {
+		if err := d.writeFile("cpu.rt_runtime_us", strconv.FormatInt(cgroup.Resources.CpuRtRuntime, 10)); err != nil {
 			return err
 		}
 	}
@@ -74,36 +78,54 @@ func (s *CpuGroup) SetRtSched(path string, cgroup *CgroupConfig) error {
 }
 
 func (s *CpuGroup) Set(path string, cgroup *CgroupConfig) error {
+	return s.set(pathDir(path), cgroup)
+}
+
+func (s *CpuGroup) set(d *cgroupDir, cgroup *CgroupConfig) error {
 	if cgroup.Resources.CpuShares != 0 {
 		shares := cgroup.Resources.CpuShares
-		if err := WriteFile(path, "cpu.shares", strconv.FormatUint(shares, 10)); err != nil {
+		if err := d.writeFile("cpu.shares", strconv.FormatUint(shares, 10)); err != nil {
 			return err
 		}
-		sharesRead, err := GetCgroupParamUint(path, "cpu.shares")
+		sharesRead, err := d.paramUint("cpu.shares")
 		if err != nil {
 			return err
 		}
-		if shares > sharesRead {
-			return fmt.Errorf("the maximum allowed cpu-shares is %d", sharesRead)
-		} else if shares < sharesRead {
-			return fmt.Errorf("the minimum allowed cpu-shares is %d", sharesRead)
+		if shares != sharesRead {
+			e := &CgroupError{
+				Subsystem: "cpu",
+				Path:      d.path,
+				File:      "cpu.shares",
+				Value:     strconv.FormatUint(shares, 10),
+				Err:       errCpuSharesRange,
+			}
+			if shares > sharesRead {
+				e.Explanation = fmt.Sprintf("the maximum allowed cpu-shares is %d", sharesRead)
+			} else {
+				e.Explanation = fmt.Sprintf("the minimum allowed cpu-shares is %d", sharesRead)
+			}
+			return e
 		}
 	}
 	if cgroup.Resources.CpuPeriod != 0 {
-		if err := WriteFile(path, "cpu.cfs_period_us", strconv.FormatUint(cgroup.Resources.CpuPeriod, 10)); err != nil {
+		if err := d.writeFile("cpu.cfs_period_us", strconv.FormatUint(cgroup.Resources.CpuPeriod, 10)); err != nil {
 			return err
 		}
 	}
 	if cgroup.Resources.CpuQuota != 0 {
-		if err := WriteFile(path, "cpu.cfs_quota_us", strconv.FormatInt(cgroup.Resources.CpuQuota, 10)); err != nil {
+		if err := d.writeFile("cpu.cfs_quota_us", strconv.FormatInt(cgroup.Resources.CpuQuota, 10)); err != nil {
 			return err
 		}
 	}
-	return s.SetRtSched(path, cgroup)
+	return s.setRtSched(d, cgroup)
 }
 
 func (s *CpuGroup) GetStats(path string, stats *Stats) error {
-	f, err := OpenFile(path, "cpu.stat", os.O_RDONLY)
+	return s.getStats(pathDir(path), stats)
+}
+
+func (s *CpuGroup) getStats(d *cgroupDir, stats *Stats) error {
+	f, err := d.openFile("cpu.stat", os.O_RDONLY)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil
@@ -132,6 +154,31 @@ func (s *CpuGroup) GetStats(path string, stats *Stats) error {
 	return nil
 }
 
+func (s *CpuGroup) GetResources(path string, r *Resources) error {
+	return s.getResources(pathDir(path), r)
+}
+
+func (s *CpuGroup) getResources(d *cgroupDir, r *Resources) error {
+	var err error
+	if r.CpuShares, err = d.paramUint("cpu.shares"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if r.CpuPeriod, err = d.paramUint("cpu.cfs_period_us"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if r.CpuQuota, err = d.paramInt("cpu.cfs_quota_us"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// The rt files only exist with CONFIG_RT_GROUP_SCHED.
+	if r.CpuRtPeriod, err = d.paramUint("cpu.rt_period_us"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if r.CpuRtRuntime, err = d.paramInt("cpu.rt_runtime_us"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 func (s *CpuGroup) Cleanup() {
 	os.RemoveAll(s.CgroupPath)
 }
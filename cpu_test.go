@@ -244,3 +244,33 @@ func TestCpuSetRtSchedAtApply(t *testing.T) {
 		t.Fatal("Got the wrong value, set cgroup.procs failed.")
 	}
 }
+
+func TestCpuGetResources(t *testing.T) {
+	helper := NewCgroupTestUtil("cpu", t)
+	defer helper.cleanup()
+
+	helper.writeFileContents(map[string]string{
+		"cpu.shares":        "512",
+		"cpu.cfs_quota_us":  "-1",
+		"cpu.cfs_period_us": "100000",
+	})
+
+	cpu := &CpuGroup{}
+	r := &Resources{}
+	if err := cpu.GetResources(helper.CgroupPath, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.CpuShares != 512 {
+		t.Errorf("Expected cpu.shares 512, got %d", r.CpuShares)
+	}
+	if r.CpuQuota != -1 {
+		t.Errorf("Expected cpu.cfs_quota_us -1, got %d", r.CpuQuota)
+	}
+	if r.CpuPeriod != 100000 {
+		t.Errorf("Expected cpu.cfs_period_us 100000, got %d", r.CpuPeriod)
+	}
+	if r.CpuRtRuntime != 0 || r.CpuRtPeriod != 0 {
+		t.Errorf("Expected no rt settings, got %d/%d", r.CpuRtRuntime, r.CpuRtPeriod)
+	}
+}
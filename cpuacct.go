@@ -72,26 +72,35 @@ func (s *CpuacctGroup) Set(path string, cgroup *CgroupConfig) error {
 	return nil
 }
 
+func (s *CpuacctGroup) set(d *cgroupDir, cgroup *CgroupConfig) error {
+	return nil
+}
+
 func (s *CpuacctGroup) GetStats(path string, stats *Stats) error {
-	if !PathExists(path) {
+	return s.getStats(pathDir(path), stats)
+}
+
+func (s *CpuacctGroup) getStats(d *cgroupDir, stats *Stats) error {
+	// A handle is only held on a directory that exists.
+	if d.fd < 0 && !PathExists(d.path) {
 		return nil
 	}
-	userModeUsage, kernelModeUsage, err := getCpuUsageBreakdown(path)
+	userModeUsage, kernelModeUsage, err := getCpuUsageBreakdown(d)
 	if err != nil {
 		return err
 	}
 
-	totalUsage, err := GetCgroupParamUint(path, "cpuacct.usage")
+	totalUsage, err := d.paramUint("cpuacct.usage")
 	if err != nil {
 		return err
 	}
 
-	percpuUsage, err := getPercpuUsage(path)
+	percpuUsage, err := getPercpuUsage(d)
 	if err != nil {
 		return err
 	}
 
-	percpuUsageInKernelmode, percpuUsageInUsermode, err := getPercpuUsageInModes(path)
+	percpuUsageInKernelmode, percpuUsageInUsermode, err := getPercpuUsageInModes(d)
 	if err != nil {
 		return err
 	}
@@ -105,8 +114,16 @@ func (s *CpuacctGroup) GetStats(path string, stats *Stats) error {
 	return nil
 }
 
+func (s *CpuacctGroup) GetResources(path string, r *Resources) error {
+	return nil
+}
+
+func (s *CpuacctGroup) getResources(d *cgroupDir, r *Resources) error {
+	return nil
+}
+
 // Returns user and kernel usage breakdown in nanoseconds.
-func getCpuUsageBreakdown(path string) (uint64, uint64, error) {
+func getCpuUsageBreakdown(d *cgroupDir) (uint64, uint64, error) {
 	var userModeUsage, kernelModeUsage uint64
 	const (
 		userField   = "user"
@@ -116,13 +133,13 @@ func getCpuUsageBreakdown(path string) (uint64, uint64, error) {
 	// Expected format:
 	// user <usage in ticks>
 	// system <usage in ticks>
-	data, err := ReadFile(path, cgroupCpuacctStat)
+	data, err := d.readFile(cgroupCpuacctStat)
 	if err != nil {
 		return 0, 0, err
 	}
 	fields := strings.Fields(data)
 	if len(fields) < 4 {
-		return 0, 0, fmt.Errorf("failure - %s is expected to have at least 4 fields", filepath.Join(path, cgroupCpuacctStat))
+		return 0, 0, fmt.Errorf("failure - %s is expected to have at least 4 fields", filepath.Join(d.path, cgroupCpuacctStat))
 	}
 	if fields[0] != userField {
 		return 0, 0, fmt.Errorf("unexpected field %q in %q, expected %q", fields[0], cgroupCpuacctStat, userField)
@@ -140,9 +157,9 @@ func getCpuUsageBreakdown(path string) (uint64, uint64, error) {
 	return (userModeUsage * nanosecondsInSecond) / clockTicks, (kernelModeUsage * nanosecondsInSecond) / clockTicks, nil
 }
 
-func getPercpuUsage(path string) ([]uint64, error) {
+func getPercpuUsage(d *cgroupDir) ([]uint64, error) {
 	percpuUsage := []uint64{}
-	data, err := ReadFile(path, "cpuacct.usage_percpu")
+	data, err := d.readFile("cpuacct.usage_percpu")
 	if err != nil {
 		return percpuUsage, err
 	}
@@ -156,11 +173,11 @@ func getPercpuUsage(path string) ([]uint64, error) {
 	return percpuUsage, nil
 }
 
-func getPercpuUsageInModes(path string) ([]uint64, []uint64, error) {
+func getPercpuUsageInModes(d *cgroupDir) ([]uint64, []uint64, error) {
 	usageKernelMode := []uint64{}
 	usageUserMode := []uint64{}
 
-	file, err := OpenFile(path, cgroupCpuacctUsageAll, os.O_RDONLY)
+	file, err := d.openFile(cgroupCpuacctUsageAll, os.O_RDONLY)
 	if os.IsNotExist(err) {
 		return usageKernelMode, usageUserMode, nil
 	} else if err != nil {
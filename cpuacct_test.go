@@ -89,3 +89,55 @@ func TestCpuacctStatsWithoutUsageAll(t *testing.T) {
 			expectedStats, actualStats.CpuStats.CpuUsage)
 	}
 }
+
+func TestStatsReaderMatchesGetStats(t *testing.T) {
+	helper := NewCgroupTestUtil("cpuacct", t)
+	defer helper.cleanup()
+	helper.writeFileContents(map[string]string{
+		"cpuacct.usage":        cpuAcctUsageContents,
+		"cpuacct.usage_percpu": cpuAcctUsagePerCPUContents,
+		"cpuacct.stat":         cpuAcctStatContents,
+		"cpuacct.usage_all":    cpuAcctUsageAll,
+		"cpu.stat":             "nr_periods 2000\nnr_throttled 200\nthrottled_time 18446744073709551615\n",
+	})
+
+	expected := NewStats()
+	if err := (&CpuacctGroup{}).GetStats(helper.CgroupPath, expected); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&CpuGroup{}).GetStats(helper.CgroupPath, expected); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewStatsReader(helper.CgroupPath, helper.CgroupPath)
+	defer r.Close()
+	actual := NewStats()
+	// Sample twice, to check that reused files and slices are reread.
+	for i := 0; i < 2; i++ {
+		if err := r.GetStatsInto(actual); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(expected.CpuStats, actual.CpuStats) {
+		t.Errorf("Expected %#v but found %#v", expected.CpuStats, actual.CpuStats)
+	}
+}
+
+func TestParseUintBytesMatchesParseUint(t *testing.T) {
+	for _, s := range []string{
+		"0",
+		"12262454190222160",
+		"18446744073709551615",
+		"18446744073709551616",
+		"99999999999999999999",
+		"-1",
+		"-9223372036854775809",
+		"12a",
+	} {
+		want, wantErr := ParseUint(s, 10, 64)
+		got, err := parseUintBytes([]byte(s))
+		if got != want || (err == nil) != (wantErr == nil) {
+			t.Errorf("parseUintBytes(%q): expected %d, %v, got %d, %v", s, want, wantErr, got, err)
+		}
+	}
+}
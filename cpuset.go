@@ -52,13 +52,17 @@ func (s *CpusetGroup) AddPid(path string, pid int) error {
 }
 
 func (s *CpusetGroup) Set(path string, cgroup *CgroupConfig) error {
+	return s.set(pathDir(path), cgroup)
+}
+
+func (s *CpusetGroup) set(d *cgroupDir, cgroup *CgroupConfig) error {
 	if cgroup.Resources.CpusetCpus != "" {
-		if err := WriteFile(path, "cpuset.cpus", cgroup.Resources.CpusetCpus); err != nil {
+		if err := d.writeFile("cpuset.cpus", cgroup.Resources.CpusetCpus); err != nil {
 			return err
 		}
 	}
 	if cgroup.Resources.CpusetMems != "" {
-		if err := WriteFile(path, "cpuset.mems", cgroup.Resources.CpusetMems); err != nil {
+		if err := d.writeFile("cpuset.mems", cgroup.Resources.CpusetMems); err != nil {
 			return err
 		}
 	}
@@ -69,6 +73,25 @@ func (s *CpusetGroup) GetStats(path string, stats *Stats) error {
 	return nil
 }
 
+func (s *CpusetGroup) getStats(d *cgroupDir, stats *Stats) error {
+	return nil
+}
+
+func (s *CpusetGroup) GetResources(path string, r *Resources) error {
+	return s.getResources(pathDir(path), r)
+}
+
+func (s *CpusetGroup) getResources(d *cgroupDir, r *Resources) error {
+	var err error
+	if r.CpusetCpus, err = d.paramString("cpuset.cpus"); err != nil {
+		return err
+	}
+	if r.CpusetMems, err = d.paramString("cpuset.mems"); err != nil {
+		return err
+	}
+	return nil
+}
+
 // Get the source mount point of directory passed in as argument.
 func getMount(dir string) (string, error) {
 	mi, err := mountinfo.GetMounts(mountinfo.ParentsFilter(dir))
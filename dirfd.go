@@ -0,0 +1,252 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrCgroupGone is returned when a cgroup directory held open by a manager
+// has been removed, or removed and recreated, since it was opened.
+var ErrCgroupGone = errors.New("cgroup gone")
+
+// cgroupDir is an O_PATH handle a manager holds on one of its cgroup
+// directories. Files opened through it are resolved relative to the handle
+// instead of walking the full path again, and a directory removed, or
+// removed and recreated, under the manager is reported as ErrCgroupGone.
+// A cgroupDir made by pathDir has no handle (fd is -1) and opens its files
+// by path, beneath root.
+type cgroupDir struct {
+	path string
+	fd   int
+	dev  uint64
+	ino  uint64
+	root *cgroupfsRoot
+	// written, if not nil, records the files written through d.
+	written map[string]bool
+}
+
+// openCgroupDir takes a handle on the directory at path, under root. The
+// handle is closed by close, or when it is garbage collected.
+func openCgroupDir(root *cgroupfsRoot, path string) (*cgroupDir, error) {
+	fd, err := unix.Open(path, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		unix.Close(fd)
+		return nil, &os.PathError{Op: "fstat", Path: path, Err: err}
+	}
+	d := &cgroupDir{path: path, fd: fd, dev: st.Dev, ino: st.Ino, root: root}
+	runtime.SetFinalizer(d, (*cgroupDir).close)
+	return d, nil
+}
+
+// dup returns a handle on the same directory that is closed independently
+// of d. A d without a handle is returned as is.
+func (d *cgroupDir) dup() *cgroupDir {
+	if d.fd < 0 {
+		return d
+	}
+	fd, err := unix.FcntlInt(uintptr(d.fd), unix.F_DUPFD_CLOEXEC, 0)
+	runtime.KeepAlive(d)
+	if err != nil {
+		return d.root.pathDir(d.path)
+	}
+	dup := &cgroupDir{path: d.path, fd: fd, dev: d.dev, ino: d.ino, root: d.root}
+	runtime.SetFinalizer(dup, (*cgroupDir).close)
+	return dup
+}
+
+func (d *cgroupDir) close() {
+	if d.fd < 0 {
+		return
+	}
+	unix.Close(d.fd)
+	d.fd = -1
+	runtime.SetFinalizer(d, nil)
+}
+
+// pathDir returns a cgroupDir without a handle, whose files are opened by
+// path with OpenFile. It is what the package level functions taking a path
+// use.
+func pathDir(path string) *cgroupDir {
+	return defaultCgroupfsRoot.pathDir(path)
+}
+
+// openFile opens file, which must be a plain file name, in the directory.
+func (d *cgroupDir) openFile(file string, flags int) (*os.File, error) {
+	if d.fd < 0 {
+		return d.root.openFile(d.path, file, flags)
+	}
+	if !isPlainFileName(file) {
+		return nil, fmt.Errorf("cgroup: invalid file name %q", file)
+	}
+	if TestMode && flags&os.O_WRONLY != 0 {
+		flags |= os.O_TRUNC | os.O_CREATE
+	}
+	fd, err := unix.Openat(d.fd, file, flags|unix.O_CLOEXEC|unix.O_NOFOLLOW, 0)
+	runtime.KeepAlive(d)
+	if err != nil {
+		if err == unix.ENOENT && d.gone() {
+			err = ErrCgroupGone
+		}
+		return nil, &os.PathError{Op: "openat", Path: d.path + "/" + file, Err: err}
+	}
+	return os.NewFile(uintptr(fd), d.path+"/"+file), nil
+}
+
+// readFile is ReadFile in the directory.
+func (d *cgroupDir) readFile(file string) (string, error) {
+	f, err := d.openFile(file, unix.O_RDONLY)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(f)
+	return buf.String(), err
+}
+
+// writeFile is WriteFile in the directory.
+func (d *cgroupDir) writeFile(file, data string) error {
+	f, err := d.openFile(file, unix.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := retryingWriteFile(f, data); err != nil {
+		return newCgroupError(d.path, file, data, err)
+	}
+	if d.written != nil {
+		d.written[d.path+"/"+file] = true
+	}
+	return nil
+}
+
+// recordWrites returns d recording the files written through it in
+// written, by path. The result must not outlive d.
+func (d *cgroupDir) recordWrites(written map[string]bool) *cgroupDir {
+	r := *d
+	r.written = written
+	return &r
+}
+
+// paramString is GetCgroupParamString in the directory.
+func (d *cgroupDir) paramString(file string) (string, error) {
+	contents, err := d.readFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(contents), nil
+}
+
+// paramUint is GetCgroupParamUint in the directory.
+func (d *cgroupDir) paramUint(file string) (uint64, error) {
+	contents, err := d.paramString(file)
+	if err != nil {
+		return 0, err
+	}
+	if contents == "max" {
+		return math.MaxUint64, nil
+	}
+	res, err := ParseUint(contents, 10, 64)
+	if err != nil {
+		return res, fmt.Errorf("unable to parse file %q", d.path+"/"+file)
+	}
+	return res, nil
+}
+
+// paramInt is GetCgroupParamInt in the directory.
+func (d *cgroupDir) paramInt(file string) (int64, error) {
+	contents, err := d.paramString(file)
+	if err != nil {
+		return 0, err
+	}
+	if contents == "max" {
+		return math.MaxInt64, nil
+	}
+	res, err := strconv.ParseInt(contents, 10, 64)
+	if err != nil {
+		return res, fmt.Errorf("unable to parse file %q", d.path+"/"+file)
+	}
+	return res, nil
+}
+
+// isCgroup2 is isCgroup2Dir for the directory.
+func (d *cgroupDir) isCgroup2() bool {
+	if d.fd < 0 {
+		return isCgroup2Dir(d.path)
+	}
+	var st unix.Statfs_t
+	err := unix.Fstatfs(d.fd, &st)
+	runtime.KeepAlive(d)
+	return err == nil && st.Type == unix.CGROUP2_SUPER_MAGIC
+}
+
+// gone reports whether the directory the handle refers to is no longer the
+// one found at its path.
+func (d *cgroupDir) gone() bool {
+	var st unix.Stat_t
+	if err := unix.Stat(d.path, &st); err != nil {
+		return true
+	}
+	return st.Dev != d.dev || st.Ino != d.ino
+}
+
+func isPlainFileName(file string) bool {
+	return file != "" && file != "." && file != ".." && !strings.Contains(file, "/")
+}
+
+// openDirs takes a handle on every path of the manager that exists, and
+// drops the ones it held before. Must be called with m.mu held.
+func (m *manager) openDirs() {
+	m.closeDirs()
+	m.dirs = make(map[string]*cgroupDir)
+	for name, path := range m.paths {
+		d, err := openCgroupDir(m.fsRoot, path)
+		if err != nil {
+			continue
+		}
+		m.dirs[name] = d
+	}
+}
+
+// closeDirs must be called with m.mu held.
+func (m *manager) closeDirs() {
+	for _, d := range m.dirs {
+		d.close()
+	}
+	m.dirs = nil
+}
+
+// dir returns the directory of subsystem name: the handle the manager holds
+// on it, or one opening its files by path if the manager holds none. Must be
+// called with m.mu held, and the result only used while it is.
+func (m *manager) dir(name string) *cgroupDir {
+	path := m.paths[name]
+	if d := m.dirs[name]; d != nil && d.path == path {
+		return d
+	}
+	return m.fsRoot.pathDir(path)
+}
+
+// Close releases the directory handles held by the manager, and its handle
+// on the cgroupfs root it was given.
+func (m *manager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closeDirs()
+	m.fsRoot.close()
+	return nil
+}
@@ -0,0 +1,122 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestCgroupDirHandle(t *testing.T) {
+	helper := NewCgroupTestUtil("cpu", t)
+	defer helper.cleanup()
+
+	helper.writeFileContents(map[string]string{
+		"cpu.shares": "1024",
+	})
+
+	paths := map[string]string{"cpu": helper.CgroupPath}
+	m := NewManager(&CgroupConfig{Resources: &Resources{}}, paths, false)
+	defer m.Close()
+	if m.(*manager).dirs["cpu"] == nil {
+		t.Fatal("Expected manager to hold a handle on its cgroup")
+	}
+
+	if err := m.Set(&Config{Cgroups: &CgroupConfig{Resources: &Resources{CpuShares: 512}}}); err != nil {
+		t.Fatal(err)
+	}
+	value, err := GetCgroupParamUint(helper.CgroupPath, "cpu.shares")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != 512 {
+		t.Fatalf("Expected cpu.shares 512, got %d", value)
+	}
+
+	// Remove and recreate the cgroup under the manager.
+	if err := os.RemoveAll(helper.CgroupPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(helper.CgroupPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	helper.writeFileContents(map[string]string{
+		"cpu.shares": "1024",
+	})
+
+	config := &Config{Cgroups: &CgroupConfig{Resources: &Resources{CpuShares: 256}}}
+	if err := m.Set(config); !errors.Is(err, ErrCgroupGone) {
+		t.Fatalf("Expected ErrCgroupGone from Set, got %v", err)
+	}
+	if _, err := m.GetStats(); !errors.Is(err, ErrCgroupGone) {
+		t.Fatalf("Expected ErrCgroupGone from GetStats, got %v", err)
+	}
+
+	// Neither the package level functions nor a new manager are affected
+	// by the stale handle.
+	if err := WriteFile(helper.CgroupPath, "cpu.shares", "2048"); err != nil {
+		t.Fatal(err)
+	}
+	m2 := NewManager(&CgroupConfig{Resources: &Resources{}}, paths, false)
+	defer m2.Close()
+	if err := m2.Set(config); err != nil {
+		t.Fatal(err)
+	}
+	value, err = GetCgroupParamUint(helper.CgroupPath, "cpu.shares")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != 256 {
+		t.Fatalf("Expected cpu.shares 256, got %d", value)
+	}
+
+	m.Close()
+	if m.(*manager).dirs != nil {
+		t.Error("Expected handles to be released on Close")
+	}
+}
+
+func TestCgroupDirHandleRenamed(t *testing.T) {
+	helper := NewCgroupTestUtil("freezer", t)
+	defer helper.cleanup()
+
+	helper.writeFileContents(map[string]string{
+		"freezer.state": string(Thawed),
+	})
+
+	paths := map[string]string{"freezer": helper.CgroupPath}
+	m := NewManager(&CgroupConfig{Resources: &Resources{}}, paths, false)
+	defer m.Close()
+
+	// Move the cgroup away and put another directory at its path: the
+	// manager keeps writing to the directory it opened.
+	moved := helper.CgroupPath + ".moved"
+	if err := os.Rename(helper.CgroupPath, moved); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(helper.CgroupPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	helper.writeFileContents(map[string]string{
+		"freezer.state": string(Thawed),
+	})
+
+	if err := m.Freeze(Frozen); err != nil {
+		t.Fatal(err)
+	}
+	state, err := GetCgroupParamString(moved, "freezer.state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != string(Frozen) {
+		t.Errorf("Expected the opened directory to be frozen, got %s", state)
+	}
+	state, err = GetCgroupParamString(helper.CgroupPath, "freezer.state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != string(Thawed) {
+		t.Errorf("Expected the directory now at the path to be left alone, got %s", state)
+	}
+}
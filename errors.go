@@ -0,0 +1,119 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// errCpuSharesRange is the error of a CgroupError for a cpu.shares value
+// the kernel clamped.
+var errCpuSharesRange = errors.New("cpu-shares out of range")
+
+// CgroupError is returned when a value could not be written to a cgroup
+// file. Explanation, when set, tells in plain words why the kernel most
+// likely refused it.
+type CgroupError struct {
+	Subsystem   string
+	Path        string
+	File        string
+	Value       string
+	Errno       unix.Errno
+	Explanation string
+	Err         error
+}
+
+func (e *CgroupError) Error() string {
+	msg := fmt.Sprintf("failed to write %q to %s: %v", e.Value, filepath.Join(e.Path, e.File), e.Err)
+	if e.Explanation != "" {
+		msg += " (" + e.Explanation + ")"
+	}
+	return msg
+}
+
+func (e *CgroupError) Unwrap() error {
+	return e.Err
+}
+
+// newCgroupError returns a *CgroupError for the failed write of value to
+// file in dir.
+func newCgroupError(dir, file, value string, err error) *CgroupError {
+	e := &CgroupError{
+		Subsystem: fileSubsystem(file),
+		Path:      dir,
+		File:      file,
+		Value:     value,
+		Err:       err,
+	}
+	if errors.As(err, &e.Errno) {
+		e.Explanation = explainErrno(dir, file, e.Errno)
+	}
+	return e
+}
+
+// fileSubsystem returns the subsystem a cgroup file belongs to, from its
+// prefix: "cpuset" for cpuset.cpus, "cgroup" for the core files.
+func fileSubsystem(file string) string {
+	if i := strings.IndexByte(file, '.'); i > 0 {
+		return file[:i]
+	}
+	return ""
+}
+
+// explainErrno guesses why writing file in dir failed with errno.
+func explainErrno(dir, file string, errno unix.Errno) string {
+	switch errno {
+	case unix.EACCES, unix.EPERM:
+		return "the cgroup is not writable, or not delegated to the current user"
+	case unix.EROFS:
+		return "the cgroup filesystem is mounted read-only"
+	}
+
+	switch file {
+	case "cpuset.cpus", "cpuset.mems":
+		switch errno {
+		case unix.EINVAL:
+			if parent, err := ReadFile(filepath.Dir(dir), file); err == nil {
+				return fmt.Sprintf("not a subset of the parent's %s %q, or not online", file, strings.TrimSpace(parent))
+			}
+			return fmt.Sprintf("not a subset of the parent's %s, or not online", file)
+		case unix.ERANGE:
+			return "refers to cpus or memory nodes beyond the ones of the system"
+		case unix.EBUSY:
+			return "child cgroups still use the cpus or memory nodes being removed"
+		}
+	case "cpu.rt_runtime_us", "cpu.rt_period_us":
+		if errno == unix.EINVAL || errno == unix.EBUSY {
+			if parent, err := ReadFile(filepath.Dir(dir), "cpu.rt_runtime_us"); err == nil {
+				return fmt.Sprintf("exceeds the real-time budget left by the parent's cpu.rt_runtime_us %q and its other children", strings.TrimSpace(parent))
+			}
+			return "exceeds the real-time budget left by the parent and its other children"
+		}
+	case "cpu.cfs_quota_us", "cpu.cfs_period_us":
+		if errno == unix.EINVAL {
+			return "out of range, or above the quota of a parent cgroup"
+		}
+	case CgroupProcesses, CgroupTasks, CgroupThreads:
+		switch errno {
+		case unix.ENOSPC:
+			return "the cgroup has an empty cpuset.cpus or cpuset.mems"
+		case unix.EOPNOTSUPP:
+			if file == CgroupThreads {
+				return "the cgroup is not threaded, so single threads can not be moved into it"
+			}
+			return "the cgroup has controllers enabled for its children, so it can not have processes itself"
+		case unix.ESRCH:
+			return "the process does not exist"
+		}
+	}
+
+	if errno == unix.EBUSY {
+		return "the cgroup has child cgroups or processes that prevent the change"
+	}
+	return ""
+}
@@ -0,0 +1,75 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestCgroupErrorCpusetOutOfRange(t *testing.T) {
+	const cpusetMount = "/sys/fs/cgroup/cpuset"
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	if _, err := os.Stat(filepath.Join(cpusetMount, "cpuset.cpus")); err != nil {
+		t.Skip(err)
+	}
+
+	dir := filepath.Join(cpusetMount, fmt.Sprintf("test-cgroup-error-%d", time.Now().Nanosecond()))
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(dir)
+
+	err := WriteFile(dir, "cpuset.cpus", "4095")
+	var cerr *CgroupError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("Expected *CgroupError, got %v", err)
+	}
+	if cerr.Subsystem != "cpuset" || cerr.File != "cpuset.cpus" || cerr.Value != "4095" || cerr.Path != dir {
+		t.Errorf("Unexpected error fields %+v", cerr)
+	}
+	if cerr.Errno != unix.ERANGE || !errors.Is(err, unix.ERANGE) {
+		t.Errorf("Expected ERANGE, got %v", cerr.Errno)
+	}
+	if !strings.Contains(cerr.Explanation, "beyond the ones of the system") {
+		t.Errorf("Unexpected explanation %q", cerr.Explanation)
+	}
+}
+
+func TestExplainErrno(t *testing.T) {
+	testCases := []struct {
+		file     string
+		errno    unix.Errno
+		expected string
+	}{
+		{CgroupProcesses, unix.ENOSPC, "empty cpuset"},
+		{CgroupProcesses, unix.EOPNOTSUPP, "controllers enabled"},
+		{CgroupThreads, unix.EOPNOTSUPP, "not threaded"},
+		{"cpuset.mems", unix.EBUSY, "child cgroups"},
+		{"cpuset.cpus", unix.EINVAL, "parent's cpuset.cpus"},
+		{"freezer.state", unix.EBUSY, "child cgroups or processes"},
+		{"cpu.shares", unix.EACCES, "not delegated"},
+		{"cpu.shares", unix.EIO, ""},
+	}
+	for _, tc := range testCases {
+		got := explainErrno("/nonexistent", tc.file, tc.errno)
+		if tc.expected == "" && got != "" || !strings.Contains(got, tc.expected) {
+			t.Errorf("explainErrno(%s, %v): expected %q in %q", tc.file, tc.errno, tc.expected, got)
+		}
+	}
+	if got := fileSubsystem("cpuset.cpus"); got != "cpuset" {
+		t.Errorf("Expected subsystem cpuset, got %q", got)
+	}
+	if got := fileSubsystem(CgroupTasks); got != "" {
+		t.Errorf("Expected no subsystem for %s, got %q", CgroupTasks, got)
+	}
+}
@@ -3,9 +3,11 @@
 package cgroupManager
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"golang.org/x/sys/unix"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
@@ -53,14 +55,18 @@ func (s *FreezerGroup) AddPid(path string, pid int) error {
 }
 
 func (s *FreezerGroup) Set(path string, cgroup *CgroupConfig) error {
+	return s.set(pathDir(path), cgroup)
+}
+
+func (s *FreezerGroup) set(d *cgroupDir, cgroup *CgroupConfig) error {
 	switch cgroup.Resources.Freezer {
 	case Frozen, Thawed:
 		for {
-			if err := WriteFile(path, "freezer.state", string(cgroup.Resources.Freezer)); err != nil {
+			if err := d.writeFile("freezer.state", string(cgroup.Resources.Freezer)); err != nil {
 				return err
 			}
 
-			state, err := s.GetState(path)
+			state, err := s.getState(d)
 			if err != nil {
 				return err
 			}
@@ -83,13 +89,34 @@ func (s *FreezerGroup) GetStats(path string, stats *Stats) error {
 	return nil
 }
 
+func (s *FreezerGroup) getStats(d *cgroupDir, stats *Stats) error {
+	return nil
+}
+
+func (s *FreezerGroup) GetResources(path string, r *Resources) error {
+	return s.getResources(pathDir(path), r)
+}
+
+func (s *FreezerGroup) getResources(d *cgroupDir, r *Resources) error {
+	state, err := s.getState(d)
+	if err != nil {
+		return err
+	}
+	r.Freezer = state
+	return nil
+}
+
 func (s *FreezerGroup) Cleanup() {
 	os.RemoveAll(s.CgroupPath)
 }
 
 func (s *FreezerGroup) GetState(path string) (FreezerState, error) {
+	return s.getState(pathDir(path))
+}
+
+func (s *FreezerGroup) getState(d *cgroupDir) (FreezerState, error) {
 	for {
-		state, err := ReadFile(path, "freezer.state")
+		state, err := d.readFile("freezer.state")
 		if err != nil {
 			if os.IsNotExist(err) || errors.Is(err, unix.ENODEV) {
 				err = nil
@@ -109,3 +136,252 @@ func (s *FreezerGroup) GetState(path string) (FreezerState, error) {
 		}
 	}
 }
+
+const (
+	freezerMinBackoff = 1 * time.Millisecond
+	freezerMaxBackoff = 100 * time.Millisecond
+)
+
+// StuckTask describes a process that did not freeze in time.
+type StuckTask struct {
+	Pid   int    `json:"pid"`
+	State string `json:"state"`
+	Wchan string `json:"wchan"`
+}
+
+// FreezeTimeoutError is returned when a cgroup did not reach the requested
+// freezer state before the context was done. State is the requested state,
+// and is left unset when only waiting for a FREEZING cgroup to settle.
+type FreezeTimeoutError struct {
+	Path     string
+	State    FreezerState
+	Stuck    []StuckTask
+	Reverted bool
+	Err      error
+}
+
+func (e *FreezeTimeoutError) Error() string {
+	msg := fmt.Sprintf("timed out setting %s to %s: %v", e.Path, e.State, e.Err)
+	if e.State == Undefined {
+		msg = fmt.Sprintf("timed out waiting for %s to leave %s: %v", e.Path, Freezing, e.Err)
+	}
+	if len(e.Stuck) > 0 {
+		tasks := make([]string, 0, len(e.Stuck))
+		for _, t := range e.Stuck {
+			tasks = append(tasks, fmt.Sprintf("%d (state %s, wchan %s)", t.Pid, t.State, t.Wchan))
+		}
+		msg += "; not frozen: " + strings.Join(tasks, ", ")
+	}
+	if e.Reverted {
+		msg += "; reverted to " + string(Thawed)
+	}
+	return msg
+}
+
+func (e *FreezeTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// SetStateContext is like Set, but gives up once ctx is done instead of
+// waiting forever, polling with an increasing backoff. When freezing times
+// out, the error lists the tasks that are not frozen yet and, if revert is
+// set, the cgroup is thawed again.
+func (s *FreezerGroup) SetStateContext(ctx context.Context, path string, state FreezerState, revert bool) error {
+	return s.setStateContext(ctx, pathDir(path), state, revert)
+}
+
+func (s *FreezerGroup) setStateContext(ctx context.Context, d *cgroupDir, state FreezerState, revert bool) error {
+	switch state {
+	case Frozen, Thawed:
+	case Undefined:
+		return nil
+	default:
+		return fmt.Errorf("Invalid argument '%s' to freezer.state", string(state))
+	}
+
+	backoff := freezerMinBackoff
+	for {
+		if err := d.writeFile("freezer.state", string(state)); err != nil {
+			return err
+		}
+		current, err := d.readFile("freezer.state")
+		if err != nil {
+			return err
+		}
+		if FreezerState(strings.TrimSpace(current)) == state {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			terr := &FreezeTimeoutError{Path: d.path, State: state, Err: ctx.Err()}
+			if state == Frozen {
+				terr.Stuck = findStuckTasks(d.path)
+				if revert {
+					if err := d.writeFile("freezer.state", string(Thawed)); err == nil {
+						terr.Reverted = true
+					}
+				}
+			}
+			return terr
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > freezerMaxBackoff {
+			backoff = freezerMaxBackoff
+		}
+	}
+}
+
+// GetStateContext is like GetState, but gives up waiting for a FREEZING
+// cgroup to settle once ctx is done.
+func (s *FreezerGroup) GetStateContext(ctx context.Context, path string) (FreezerState, error) {
+	return s.getStateContext(ctx, pathDir(path))
+}
+
+func (s *FreezerGroup) getStateContext(ctx context.Context, d *cgroupDir) (FreezerState, error) {
+	backoff := freezerMinBackoff
+	for {
+		state, err := d.readFile("freezer.state")
+		if err != nil {
+			if os.IsNotExist(err) || errors.Is(err, unix.ENODEV) {
+				err = nil
+			}
+			return Undefined, err
+		}
+		switch strings.TrimSpace(state) {
+		case "THAWED":
+			return Thawed, nil
+		case "FROZEN":
+			return Frozen, nil
+		case "FREEZING":
+		default:
+			return Undefined, fmt.Errorf("unknown freezer.state %q", state)
+		}
+
+		select {
+		case <-ctx.Done():
+			return Undefined, &FreezeTimeoutError{Path: d.path, Err: ctx.Err()}
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > freezerMaxBackoff {
+			backoff = freezerMaxBackoff
+		}
+	}
+}
+
+// findStuckTasks returns the tasks below path that are not sitting in the
+// freezer, based on their state in /proc/<pid>/stat. Frozen tasks show up
+// as D, whatever their wchan is on kernels since 6.1, so only the tasks in
+// other states are reported. Errors are ignored, as this is only used for
+// diagnostics.
+func findStuckTasks(path string) []StuckTask {
+	pids, err := GetAllPids(path)
+	if err != nil {
+		return nil
+	}
+	var stuck []StuckTask
+	for _, pid := range pids {
+		stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			// The task is gone.
+			continue
+		}
+		state := parseStatState(string(stat))
+		if state == "D" {
+			continue
+		}
+		wchan, _ := ioutil.ReadFile(fmt.Sprintf("/proc/%d/wchan", pid))
+		stuck = append(stuck, StuckTask{
+			Pid:   pid,
+			State: state,
+			Wchan: string(wchan),
+		})
+	}
+	return stuck
+}
+
+// parseStatState returns the state field of a /proc/<pid>/stat line. The
+// command name may contain spaces and parentheses, so the state is taken
+// after the last closing parenthesis.
+func parseStatState(stat string) string {
+	i := strings.LastIndex(stat, ")")
+	if i < 0 {
+		return ""
+	}
+	fields := strings.Fields(stat[i+1:])
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// FreezerInfo is the freezer state of a cgroup v1 directory. State is the
+// effective state, SelfFreezing and ParentFreezing tell whether it comes
+// from the cgroup itself or from one of its ancestors.
+type FreezerInfo struct {
+	Path           string       `json:"path"`
+	State          FreezerState `json:"state"`
+	SelfFreezing   bool         `json:"self_freezing"`
+	ParentFreezing bool         `json:"parent_freezing"`
+}
+
+// GetInfo returns the freezer state of path without waiting for a
+// FREEZING cgroup to settle.
+func (s *FreezerGroup) GetInfo(path string) (*FreezerInfo, error) {
+	info := &FreezerInfo{Path: path}
+	state, err := GetCgroupParamString(path, "freezer.state")
+	if err != nil {
+		// The root cgroup has no freezer files.
+		if os.IsNotExist(err) {
+			return info, nil
+		}
+		return nil, err
+	}
+	switch FreezerState(state) {
+	case Thawed, Frozen, Freezing:
+		info.State = FreezerState(state)
+	default:
+		return nil, fmt.Errorf("unknown freezer.state %q", state)
+	}
+	if info.SelfFreezing, err = getFreezerFlag(path, "freezer.self_freezing"); err != nil {
+		return nil, err
+	}
+	if info.ParentFreezing, err = getFreezerFlag(path, "freezer.parent_freezing"); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// GetSubtreeInfo returns the freezer state of path and of every cgroup
+// below it, parents before children.
+func (s *FreezerGroup) GetSubtreeInfo(path string) ([]FreezerInfo, error) {
+	var infos []FreezerInfo
+	err := filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return nil
+		}
+		info, err := s.GetInfo(p)
+		if err != nil {
+			return err
+		}
+		infos = append(infos, *info)
+		return nil
+	})
+	return infos, err
+}
+
+// getFreezerFlag reads a 0/1 freezer file. The files are missing on old
+// kernels, in which case false is returned.
+func getFreezerFlag(path, file string) (bool, error) {
+	v, err := GetCgroupParamUint(path, file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return v != 0, nil
+}
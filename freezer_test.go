@@ -3,7 +3,15 @@
 package cgroupManager
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestFreezerSetState(t *testing.T) {
@@ -43,3 +51,113 @@ func TestFreezerSetInvalidState(t *testing.T) {
 		t.Fatal("Failed to return invalid argument error")
 	}
 }
+
+func TestFreezerGetStateContextTimeout(t *testing.T) {
+	helper := NewCgroupTestUtil("freezer", t)
+	defer helper.cleanup()
+
+	helper.writeFileContents(map[string]string{
+		"freezer.state": "FREEZING",
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	freezer := &FreezerGroup{}
+	_, err := freezer.GetStateContext(ctx, helper.CgroupPath)
+	var terr *FreezeTimeoutError
+	if !errors.As(err, &terr) {
+		t.Fatalf("Expected a FreezeTimeoutError, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected error to wrap context.DeadlineExceeded, got %v", err)
+	}
+	if terr.State != Undefined {
+		t.Errorf("Expected no requested state when only reading, got %s", terr.State)
+	}
+}
+
+func TestParseStatState(t *testing.T) {
+	stat := "1234 (a (weird) name) D 1 1234 1234 0 -1"
+	if state := parseStatState(stat); state != "D" {
+		t.Errorf("Expected state D, got %q", state)
+	}
+}
+
+func TestFindStuckTasks(t *testing.T) {
+	if IsCgroup2UnifiedMode() {
+		t.Skip("cgroup v1 only")
+	}
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+
+	cmd := exec.Command("sleep", "60")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+	go cmd.Wait()
+
+	config := &CgroupConfig{
+		Path:      fmt.Sprintf("/test-stuck-%d", time.Now().Nanosecond()),
+		Resources: &Resources{},
+	}
+	m := NewManager(config, nil, false)
+	defer m.Close()
+	if err := m.Apply(cmd.Process.Pid); err != nil {
+		t.Skip(err)
+	}
+	defer m.Destroy()
+	path := m.Path("freezer")
+	if path == "" {
+		t.Skip("freezer cgroup not available")
+	}
+
+	if stuck := findStuckTasks(path); len(stuck) != 1 || stuck[0].Pid != cmd.Process.Pid {
+		t.Errorf("Expected the thawed task to be reported, got %+v", stuck)
+	}
+	if err := m.Freeze(Frozen); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Freeze(Thawed)
+	if stuck := findStuckTasks(path); len(stuck) != 0 {
+		t.Errorf("Expected no stuck tasks once frozen, got %+v", stuck)
+	}
+}
+
+func TestFreezerGetSubtreeInfo(t *testing.T) {
+	helper := NewCgroupTestUtil("freezer", t)
+	defer helper.cleanup()
+
+	child := filepath.Join(helper.CgroupPath, "child")
+	if err := os.MkdirAll(child, 0755); err != nil {
+		t.Fatal(err)
+	}
+	helper.writeFileContents(map[string]string{
+		"freezer.state":           string(Frozen),
+		"freezer.self_freezing":   "1",
+		"freezer.parent_freezing": "0",
+	})
+	for file, contents := range map[string]string{
+		"freezer.state":           string(Frozen),
+		"freezer.self_freezing":   "0",
+		"freezer.parent_freezing": "1",
+	} {
+		if err := WriteFile(child, file, contents); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	freezer := &FreezerGroup{}
+	infos, err := freezer.GetSubtreeInfo(helper.CgroupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []FreezerInfo{
+		{Path: helper.CgroupPath, State: Frozen, SelfFreezing: true},
+		{Path: child, State: Frozen, ParentFreezing: true},
+	}
+	if !reflect.DeepEqual(infos, expected) {
+		t.Errorf("Expected %+v but found %+v", expected, infos)
+	}
+}
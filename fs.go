@@ -4,6 +4,8 @@ package cgroupManager
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -27,9 +29,10 @@ var errSubsystemDoesNotExist = errors.New("cgroup: subsystem does not exist")
 
 type subsystem interface {
 	Name() string
-	GetStats(path string, stats *Stats) error
+	getStats(d *cgroupDir, stats *Stats) error
+	getResources(d *cgroupDir, r *Resources) error
 	Apply(path string, c *cgroupData) error
-	Set(path string, cgroup *CgroupConfig) error
+	set(d *cgroupDir, cgroup *CgroupConfig) error
 	AddPid(path string, pid int) error
 }
 
@@ -38,19 +41,194 @@ type manager struct {
 	cgroups  *CgroupConfig
 	rootless bool
 	paths    map[string]string
+	dirs     map[string]*cgroupDir
+	// root overrides the detected root of the cgroup hierarchies.
+	root string
+	// fsRoot is the root the files of the cgroups are opened beneath.
+	fsRoot *cgroupfsRoot
+	// skipped holds the errors of the subsystems a rootless Apply could
+	// not join or create the cgroup of.
+	skipped map[string]error
+	// params holds the values written by SetParam, per controller and file.
+	params map[string]map[string]string
 }
 
 func NewManager(cg *CgroupConfig, paths map[string]string, rootless bool) Manager {
-	return &manager{
+	return newManager("", cg, paths, rootless)
+}
+
+// NewManagerWithRoot is like NewManager, but looks for the cgroup hierarchies
+// under root instead of the detected cgroupfs root, e.g. for cgroupfs mounted
+// in a chroot. Files under root are opened with the same openat2 protections
+// as the ones under /sys/fs/cgroup, until the manager is closed.
+func NewManagerWithRoot(root string, cg *CgroupConfig, paths map[string]string, rootless bool) (Manager, error) {
+	if err := checkRoot(root); err != nil {
+		return nil, err
+	}
+	return newManager(filepath.Clean(root), cg, paths, rootless), nil
+}
+
+func newManager(root string, cg *CgroupConfig, paths map[string]string, rootless bool) *manager {
+	m := &manager{
 		cgroups:  cg,
 		paths:    paths,
 		rootless: rootless,
+		root:     root,
+		fsRoot:   cgroupfsRootAt(root),
+	}
+	m.openDirs()
+	return m
+}
+
+func checkRoot(root string) error {
+	if !filepath.IsAbs(root) {
+		return fmt.Errorf("cgroupfs root %q is not an absolute path", root)
+	}
+	return nil
+}
+
+// NewManagerFromPid returns a Manager for the cgroups pid currently belongs
+// to, as listed in /proc/<pid>/cgroup. As with any CgroupConfig listing its
+// Paths, the cgroups are only joined: Set leaves them alone, and Destroy
+// and DestroyWithKill do not remove them.
+func NewManagerFromPid(pid int) (Manager, error) {
+	return newManagerFromPid("", pid)
+}
+
+// NewManagerFromPidWithRoot is like NewManagerFromPid, but looks for the
+// cgroup hierarchies under root, as NewManagerWithRoot does.
+func NewManagerFromPidWithRoot(root string, pid int) (Manager, error) {
+	if err := checkRoot(root); err != nil {
+		return nil, err
+	}
+	return newManagerFromPid(filepath.Clean(root), pid)
+}
+
+func newManagerFromPid(root string, pid int) (Manager, error) {
+	if isCgroup2UnifiedModeAt(root) {
+		return nil, errUnified
+	}
+	cgroups, err := ParseCgroupFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	var innerPath string
+	paths := make(map[string]string)
+	for _, sys := range allSubsystems() {
+		cgroup, err := getControllerPath(sys.Name(), cgroups)
+		if err != nil {
+			if IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		p, err := getCgroupPathHelper(root, sys.Name(), cgroup)
+		if err != nil {
+			if IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		paths[sys.Name()] = p
+
+		// Only keep a single inner path if every controller agrees on it,
+		// so that Apply resolves to the same directories again.
+		if len(paths) == 1 {
+			innerPath = cgroup
+		} else if innerPath != cgroup {
+			innerPath = ""
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no cgroup found for pid %d", pid)
 	}
+	if cgroup, ok := cgroups[""]; ok && isCgroup2HybridModeAt(root) {
+		paths[UnifiedHierarchy] = filepath.Join(hybridMountpointAt(root), cgroup)
+	}
+
+	cg := &CgroupConfig{
+		Path:       innerPath,
+		Paths:      copyPaths(paths),
+		Subsystems: registeredIn(paths),
+		Resources:  &Resources{},
+	}
+	return newManager(root, cg, paths, false), nil
+}
+
+// NewManagerFromPath returns a Manager for the existing cgroup at path,
+// relative to the root of every mounted hierarchy. Like the one of
+// NewManagerFromPid, it does not set, remove or kill the cgroup.
+func NewManagerFromPath(path string) (Manager, error) {
+	if IsCgroup2UnifiedMode() {
+		return nil, errUnified
+	}
+	root, err := getCgroupRoot()
+	if err != nil {
+		return nil, err
+	}
+	return newManagerFromPath(root, path)
 }
 
-// The absolute path to the root of the cgroup hierarchies.
+// NewManagerFromPathWithRoot is like NewManagerFromPath, but looks for the
+// cgroup hierarchies under root, as NewManagerWithRoot does.
+func NewManagerFromPathWithRoot(root, path string) (Manager, error) {
+	if err := checkRoot(root); err != nil {
+		return nil, err
+	}
+	root = filepath.Clean(root)
+	if isCgroup2UnifiedModeAt(root) {
+		return nil, errUnified
+	}
+	return newManagerFromPath(root, path)
+}
+
+func newManagerFromPath(root, path string) (Manager, error) {
+
+	innerPath := CleanPath(string(os.PathSeparator) + path)
+	paths := make(map[string]string)
+	for _, sys := range allSubsystems() {
+		mnt, err := FindCgroupMountpoint(root, sys.Name())
+		if err != nil {
+			if IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		p := filepath.Join(mnt, innerPath)
+		if !PathExists(p) {
+			continue
+		}
+		paths[sys.Name()] = p
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("cgroup %s not found in any hierarchy", innerPath)
+	}
+
+	cg := &CgroupConfig{
+		Path:       innerPath,
+		Paths:      copyPaths(paths),
+		Subsystems: registeredIn(paths),
+		Resources:  &Resources{},
+	}
+	return newManager(root, cg, paths, false), nil
+}
+
+// copyPaths returns a copy of paths, so that the config and the manager do
+// not share a map.
+func copyPaths(paths map[string]string) map[string]string {
+	c := make(map[string]string, len(paths))
+	for name, path := range paths {
+		c[name] = path
+	}
+	return c
+}
+
+// The absolute path to the root of the cgroup hierarchies, and the mount
+// table generation it was found in.
 var cgroupRootLock sync.Mutex
 var cgroupRoot string
+var cgroupRootGen uint64
 
 const defaultCgroupRoot = "/sys/fs/cgroup"
 
@@ -86,47 +264,53 @@ func tryDefaultCgroupRoot() string {
 	if err != nil {
 		return ""
 	}
-	names, err := dir.Readdirnames(1)
-	if err != nil {
-		return ""
-	}
-	if len(names) < 1 {
-		return ""
-	}
-	// ... which is a cgroup mount point.
-	err = unix.Statfs(filepath.Join(defaultCgroupRoot, names[0]), &fst)
-	if err != nil || fst.Type != unix.CGROUP_SUPER_MAGIC {
-		return ""
+	defer dir.Close()
+	for {
+		names, err := dir.Readdirnames(1)
+		if err != nil || len(names) < 1 {
+			return ""
+		}
+		// ... which is a cgroup mount point. In hybrid mode, the cgroup v2
+		// hierarchy ("unified") may come first and is skipped.
+		err = unix.Statfs(filepath.Join(defaultCgroupRoot, names[0]), &fst)
+		if err != nil {
+			return ""
+		}
+		switch fst.Type {
+		case unix.CGROUP_SUPER_MAGIC:
+			return defaultCgroupRoot
+		case unix.CGROUP2_SUPER_MAGIC:
+			continue
+		default:
+			return ""
+		}
 	}
-
-	return defaultCgroupRoot
 }
 
-// Gets the cgroupRoot.
+// Gets the cgroupRoot. It is looked up again after the mount table changed.
 func getCgroupRoot() (string, error) {
 	cgroupRootLock.Lock()
 	defer cgroupRootLock.Unlock()
 
-	if cgroupRoot != "" {
+	snap, err := getMountSnapshot()
+	if err != nil {
+		return "", err
+	}
+	if cgroupRoot != "" && cgroupRootGen == snap.gen {
 		return cgroupRoot, nil
 	}
 
 	// fast path
 	cgroupRoot = tryDefaultCgroupRoot()
 	if cgroupRoot != "" {
+		cgroupRootGen = snap.gen
 		return cgroupRoot, nil
 	}
 
 	// slow path: parse mountinfo, find the first mount where fs=cgroup
 	// (e.g. "/sys/fs/cgroup/memory"), use its parent.
-	f, err := os.Open("/proc/self/mountinfo")
-	if err != nil {
-		return "", err
-	}
-	defer f.Close()
-
 	var root string
-	scanner := bufio.NewScanner(f)
+	scanner := bufio.NewScanner(bytes.NewReader(snap.mountinfo))
 	for scanner.Scan() {
 		text := scanner.Text()
 		fields := strings.Split(text, " ")
@@ -162,6 +346,7 @@ func getCgroupRoot() (string, error) {
 	}
 
 	cgroupRoot = root
+	cgroupRootGen = snap.gen
 	return cgroupRoot, nil
 }
 
@@ -201,9 +386,12 @@ func (m *manager) Apply(pid int) (err error) {
 	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	// Hold handles on whatever paths we ended up with, even on failure.
+	defer m.openDirs()
 
 	c := m.cgroups
 	m.paths = make(map[string]string)
+	m.skipped = nil
 	if c.Paths != nil {
 		cgMap, err := ParseCgroupFile("/proc/self/cgroup")
 		if err != nil {
@@ -221,8 +409,17 @@ func (m *manager) Apply(pid int) (err error) {
 	if err != nil {
 		return err
 	}
+	if m.root != "" {
+		d.root = m.root
+	}
+	if err := checkSubsystems(c); err != nil {
+		return err
+	}
+	if err := d.checkRequired(); err != nil {
+		return err
+	}
 
-	for _, sys := range subsystems {
+	for _, sys := range activeSubsystems(c) {
 		p, err := d.path(sys.Name())
 		if err != nil {
 			// The non-presence of the devices subsystem is
@@ -239,14 +436,32 @@ func (m *manager) Apply(pid int) (err error) {
 			// explicit cgroup path hasn't been set, we don't bail on error in
 			// case of permission problems. Cases where limits have been set
 			// (and we couldn't create our own cgroup) are handled by Set.
-			if isIgnorableError(m.rootless, err) && m.cgroups.Path == "" {
+			if isIgnorableError(m.rootless, err) && m.cgroups.Path == "" && !d.required(sys.Name()) {
 				delete(m.paths, sys.Name())
+				if m.skipped == nil {
+					m.skipped = make(map[string]error)
+				}
+				m.skipped[sys.Name()] = err
 				continue
 			}
 			return err
 		}
 
 	}
+
+	if d.hybrid() && d.joins(UnifiedHierarchy) {
+		p, err := d.unifiedPath()
+		if err != nil {
+			return err
+		}
+		if err := join(p, pid); err != nil {
+			if isIgnorableError(m.rootless, err) && m.cgroups.Path == "" && !d.required(UnifiedHierarchy) {
+				return nil
+			}
+			return err
+		}
+		m.paths[UnifiedHierarchy] = p
+	}
 	return nil
 }
 
@@ -256,6 +471,7 @@ func (m *manager) Destroy() error {
 	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.closeDirs()
 	return RemovePaths(m.paths)
 }
 
@@ -269,18 +485,34 @@ func (m *manager) GetStats() (*Stats, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	stats := NewStats()
-	for _, sys := range subsystems {
-		path := m.paths[sys.Name()]
-		if path == "" {
+	for _, sys := range activeSubsystems(m.cgroups) {
+		if m.paths[sys.Name()] == "" {
 			continue
 		}
-		if err := sys.GetStats(path, stats); err != nil {
+		if err := sys.getStats(m.dir(sys.Name()), stats); err != nil {
 			return nil, err
 		}
 	}
 	return stats, nil
 }
 
+// GetLiveResources reads the settings currently applied by the kernel for
+// each joined subsystem, which may differ from the configured ones.
+func (m *manager) GetLiveResources() (*Resources, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := &Resources{}
+	for _, sys := range activeSubsystems(m.cgroups) {
+		if m.paths[sys.Name()] == "" {
+			continue
+		}
+		if err := sys.getResources(m.dir(sys.Name()), r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
 func (m *manager) Set(container *Config) error {
 	if container.Cgroups == nil {
 		return nil
@@ -294,15 +526,13 @@ func (m *manager) Set(container *Config) error {
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	for _, sys := range subsystems {
+	container = m.withParams(container)
+	if m.rootless {
+		return m.setRootless(container)
+	}
+	for _, sys := range activeSubsystems(m.cgroups) {
 		path := m.paths[sys.Name()]
-		if err := sys.Set(path, container.Cgroups); err != nil {
-			if m.rootless && sys.Name() == "devices" {
-				continue
-			}
-			// When m.Rootless is true, errors from the device subsystem are ignored because it is really not expected to work.
-			// However, errors from other subsystems are not ignored.
-			// see @test "runc create (rootless + limits + no cgrouppath + no permission) fails with informative error"
+		if err := sys.set(m.dir(sys.Name()), container.Cgroups); err != nil {
 			if path == "" {
 				// We never created a path for this cgroup, so we cannot set
 				// limits for it (though we have already tried at this point).
@@ -318,21 +548,43 @@ func (m *manager) Set(container *Config) error {
 // Freeze toggles the container's freezer cgroup depending on the state
 // provided
 func (m *manager) Freeze(state FreezerState) error {
-	path := m.Path("freezer")
-	if m.cgroups == nil || path == "" {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cgroups == nil || m.paths["freezer"] == "" {
 		return errors.New("cannot toggle freezer: cgroups not configured for container")
 	}
 
 	prevState := m.cgroups.Resources.Freezer
 	m.cgroups.Resources.Freezer = state
 	freezer := &FreezerGroup{}
-	if err := freezer.Set(path, m.cgroups); err != nil {
+	if err := freezer.set(m.dir("freezer"), m.cgroups); err != nil {
 		m.cgroups.Resources.Freezer = prevState
 		return err
 	}
 	return nil
 }
 
+// FreezeContext is like Freeze, but gives up once ctx is done. If freezing
+// times out and revert is set, the container is thawed again.
+func (m *manager) FreezeContext(ctx context.Context, state FreezerState, revert bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cgroups == nil || m.paths["freezer"] == "" {
+		return errors.New("cannot toggle freezer: cgroups not configured for container")
+	}
+
+	freezer := &FreezerGroup{}
+	if err := freezer.setStateContext(ctx, m.dir("freezer"), state, revert); err != nil {
+		var terr *FreezeTimeoutError
+		if errors.As(err, &terr) && terr.Reverted {
+			m.cgroups.Resources.Freezer = Thawed
+		}
+		return err
+	}
+	m.cgroups.Resources.Freezer = state
+	return nil
+}
+
 func (m *manager) GetPids() ([]int, error) {
 	return GetPids(m.Path("devices"))
 }
@@ -341,6 +593,48 @@ func (m *manager) GetAllPids() ([]int, error) {
 	return GetAllPids(m.Path("devices"))
 }
 
+// AddThread moves the single thread tid into all of the manager's cgroups.
+// cgroup v2 directories that are not threaded, such as the unified
+// hierarchy joined in hybrid mode, can not hold single threads of a process
+// and are skipped.
+func (m *manager) AddThread(tid int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	threadPaths := threadedPaths(m.paths)
+	if len(threadPaths) == 0 && len(m.paths) > 0 {
+		return fmt.Errorf("cannot add thread %d: none of the cgroups is threaded", tid)
+	}
+	for name, path := range threadPaths {
+		d := m.dir(name)
+		if d.fd < 0 && !PathExists(path) {
+			continue
+		}
+		if err := writeCgroupID(d, threadsFile(d), tid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetThreads returns the threads directly in any of the manager's cgroups,
+// leaving out the cgroup v2 directories that are not threaded.
+func (m *manager) GetThreads() ([]int, error) {
+	return collectPids(threadedPaths(m.GetPaths()), GetThreads)
+}
+
+// threadedPaths returns the paths that can hold single threads: all the
+// cgroup v1 ones, and the threaded cgroup v2 ones.
+func threadedPaths(paths map[string]string) map[string]string {
+	threaded := make(map[string]string, len(paths))
+	for name, path := range paths {
+		if isCgroup2Dir(path) && !isThreadedCgroup(path) {
+			continue
+		}
+		threaded[name] = path
+	}
+	return threaded
+}
+
 func getCgroupData(c *CgroupConfig, pid int) (*cgroupData, error) {
 	root, err := getCgroupRoot()
 	if err != nil {
@@ -385,7 +679,7 @@ func (raw *cgroupData) path(subsystem string) (string, error) {
 	// Use GetOwnCgroupPath instead of GetInitCgroupPath, because the creating
 	// process could in container and shared pid namespace with host, and
 	// /proc/1/cgroup could point to whole other world of cgroups.
-	parentPath, err := GetOwnCgroupPath(subsystem)
+	parentPath, err := GetOwnCgroupPathAt(raw.root, subsystem)
 	if err != nil {
 		return "", err
 	}
@@ -393,6 +687,75 @@ func (raw *cgroupData) path(subsystem string) (string, error) {
 	return filepath.Join(parentPath, raw.innerPath), nil
 }
 
+// hybrid reports whether a cgroup v2 hierarchy without controllers is
+// mounted next to the v1 ones under raw.root.
+func (raw *cgroupData) hybrid() bool {
+	return isCgroup2HybridModeAt(raw.root)
+}
+
+// checkRequired returns an error if one of the controllers the config
+// requires is not available, before any cgroup is created.
+func (raw *cgroupData) checkRequired() error {
+	for _, ctrl := range raw.config.Controllers {
+		if !ctrl.Required {
+			continue
+		}
+		if ctrl.Name == UnifiedHierarchy {
+			if !raw.hybrid() {
+				return fmt.Errorf("cgroup: required controller %s is not available", ctrl.Name)
+			}
+			continue
+		}
+		if _, err := raw.path(ctrl.Name); err != nil {
+			return fmt.Errorf("cgroup: required controller %s is not available: %v", ctrl.Name, err)
+		}
+	}
+	return nil
+}
+
+// required reports whether the config lists the controller name as
+// Required, in which case Apply may not skip it.
+func (raw *cgroupData) required(name string) bool {
+	for _, ctrl := range raw.config.Controllers {
+		if ctrl.Name == name {
+			return ctrl.Required
+		}
+	}
+	return false
+}
+
+// joins reports whether the config selects the controller name, which it
+// does for all of them if it does not list its Controllers.
+func (raw *cgroupData) joins(name string) bool {
+	if len(raw.config.Controllers) == 0 {
+		return true
+	}
+	for _, ctrl := range raw.config.Controllers {
+		if ctrl.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// unifiedPath returns the path of the cgroup in the cgroup v2 hierarchy of
+// a hybrid mode host.
+func (raw *cgroupData) unifiedPath() (string, error) {
+	mnt := hybridMountpointAt(raw.root)
+	if filepath.IsAbs(raw.innerPath) {
+		return filepath.Join(mnt, raw.innerPath), nil
+	}
+	cgroups, err := ParseCgroupFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	own, ok := cgroups[""]
+	if !ok {
+		return "", NewNotFoundError(UnifiedHierarchy)
+	}
+	return filepath.Join(mnt, own, raw.innerPath), nil
+}
+
 func join(path string, pid int) error {
 	if path == "" {
 		return nil
@@ -414,13 +777,25 @@ func (m *manager) GetCgroups() (*CgroupConfig, error) {
 }
 
 func (m *manager) GetFreezerState() (FreezerState, error) {
-	dir := m.Path("freezer")
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	// If the container doesn't have the freezer cgroup, say it's undefined.
-	if dir == "" {
+	if m.paths["freezer"] == "" {
 		return Undefined, nil
 	}
 	freezer := &FreezerGroup{}
-	return freezer.GetState(dir)
+	return freezer.getState(m.dir("freezer"))
+}
+
+// GetFreezerSubtree returns the freezer state of the container's cgroup and
+// of every cgroup below it.
+func (m *manager) GetFreezerSubtree() ([]FreezerInfo, error) {
+	dir := m.Path("freezer")
+	if dir == "" {
+		return nil, errors.New("cannot get freezer state: cgroups not configured for container")
+	}
+	freezer := &FreezerGroup{}
+	return freezer.GetSubtreeInfo(dir)
 }
 
 func (m *manager) Exists() bool {
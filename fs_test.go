@@ -3,9 +3,16 @@
 package cgroupManager
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 func TestInvalidCgroupPath(t *testing.T) {
@@ -101,3 +108,311 @@ func TestTryDefaultCgroupRoot(t *testing.T) {
 		t.Errorf("tryDefaultCgroupRoot: want %q, got %q", exp, res)
 	}
 }
+
+func TestNewManagerFromPid(t *testing.T) {
+	if IsCgroup2UnifiedMode() {
+		t.Skip("cgroup v2 is not supported")
+	}
+
+	m, err := NewManagerFromPid(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	exp, err := GetOwnCgroupPath("cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Path("cpu"); got != exp {
+		t.Errorf("NewManagerFromPid: want cpu path %q, got %q", exp, got)
+	}
+}
+
+func TestNewManagerFromPath(t *testing.T) {
+	if IsCgroup2UnifiedMode() {
+		t.Skip("cgroup v2 is not supported")
+	}
+
+	m, err := NewManagerFromPath("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	for name, path := range m.GetPaths() {
+		if !PathExists(filepath.Join(path, CgroupProcesses)) {
+			t.Errorf("NewManagerFromPath: %s path %q is not a cgroup", name, path)
+		}
+	}
+
+	if _, err := NewManagerFromPath("/does-not-exist-cgroup-test"); err == nil {
+		t.Error("NewManagerFromPath: expected error for missing cgroup")
+	}
+}
+
+func TestNewManagerFromPathDestroy(t *testing.T) {
+	if IsCgroup2UnifiedMode() {
+		t.Skip("cgroup v2 is not supported")
+	}
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+
+	config := &CgroupConfig{
+		Path:      fmt.Sprintf("/test-from-path-%d", time.Now().Nanosecond()),
+		Resources: &Resources{},
+	}
+	owner := NewManager(config, nil, false)
+	defer owner.Close()
+	if err := owner.Apply(-1); err != nil {
+		t.Skip(err)
+	}
+	defer owner.Destroy()
+
+	m, err := NewManagerFromPath(config.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if err := m.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DestroyWithKill(); err != nil {
+		t.Fatal(err)
+	}
+	for name, path := range m.GetPaths() {
+		if !PathExists(path) {
+			t.Errorf("Expected %s cgroup %s not to be removed", name, path)
+		}
+	}
+}
+
+func TestApplyHybridMode(t *testing.T) {
+	if !IsCgroup2HybridMode() {
+		t.Skip("not running in hybrid mode")
+	}
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+
+	config := &CgroupConfig{
+		Path:      fmt.Sprintf("/test-hybrid-%d", time.Now().Nanosecond()),
+		Resources: &Resources{},
+	}
+	m := NewManager(config, nil, false)
+	defer m.Close()
+	if err := m.Apply(-1); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Destroy()
+
+	path := m.Path(UnifiedHierarchy)
+	if path != filepath.Join(hybridMountpoint, config.Path) {
+		t.Fatalf("Expected unified path under %s, got %q", hybridMountpoint, path)
+	}
+	if !isCgroup2Dir(path) {
+		t.Errorf("Expected %s to be a cgroup v2 directory", path)
+	}
+}
+
+func TestAddThreadAfterApply(t *testing.T) {
+	if IsCgroup2UnifiedMode() {
+		t.Skip("cgroup v1 only")
+	}
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+
+	config := &CgroupConfig{
+		Path:      fmt.Sprintf("/test-addthread-%d", time.Now().Nanosecond()),
+		Resources: &Resources{},
+	}
+	m := NewManager(config, nil, false)
+	defer m.Close()
+	if err := m.Apply(-1); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Destroy()
+
+	errCh := make(chan error, 1)
+	tidCh := make(chan int, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		// The thread is left in the test cgroups, never unlock it so that
+		// it exits with the goroutine.
+		runtime.LockOSThread()
+		tid := unix.Gettid()
+		tidCh <- tid
+		errCh <- m.AddThread(tid)
+		<-done
+	}()
+	tid := <-tidCh
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+
+	tids, err := m.GetThreads()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, t := range tids {
+		if t == tid {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected thread %d in %v", tid, tids)
+	}
+}
+
+func TestNewManagerWithRoot(t *testing.T) {
+	if IsCgroup2UnifiedMode() {
+		t.Skip("cgroup v1 only")
+	}
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+
+	root, err := ioutil.TempDir("", "cgroupfs-root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := unix.Mount("tmpfs", root, "tmpfs", 0, ""); err != nil {
+		t.Skip(err)
+	}
+	defer unix.Unmount(root, unix.MNT_DETACH)
+	freezer := filepath.Join(root, "freezer")
+	if err := os.Mkdir(freezer, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := unix.Mount("cgroup", freezer, "cgroup", 0, "freezer"); err != nil {
+		t.Skip(err)
+	}
+	defer unix.Unmount(freezer, unix.MNT_DETACH)
+
+	config := &CgroupConfig{
+		Path:      fmt.Sprintf("/test-root-%d", time.Now().Nanosecond()),
+		Resources: &Resources{},
+	}
+	m, err := NewManagerWithRoot(root, config, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if err := m.Apply(-1); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Destroy()
+
+	path := m.Path("freezer")
+	if path != filepath.Join(freezer, config.Path) {
+		t.Fatalf("Expected freezer path under %s, got %q", freezer, path)
+	}
+	for name, p := range m.GetPaths() {
+		if name != "freezer" && strings.HasPrefix(p, root+"/") {
+			t.Errorf("Unexpected %s path %q under %s", name, p, root)
+		}
+	}
+
+	fm, err := NewManagerFromPathWithRoot(root, config.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+	if p := fm.Path("freezer"); p != path {
+		t.Errorf("Expected NewManagerFromPathWithRoot to find %s, got %q", path, p)
+	}
+
+	// Go through the root of the manager rather than the held directory
+	// handle.
+	fsRoot := m.(*manager).fsRoot
+	if fsRoot == defaultCgroupfsRoot {
+		t.Fatal("Expected the manager to have its own cgroupfs root")
+	}
+	f, err := fsRoot.openFile(filepath.Dir(path), filepath.Base(path)+"/freezer.state", os.O_RDONLY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if fsRoot.err == nil && fsRoot.fd < 0 {
+		t.Fatal("Expected the files to be opened with openat2 beneath the root")
+	}
+	if _, err := fsRoot.openFile(freezer, "../../etc/passwd", os.O_RDONLY); err == nil {
+		t.Error("Expected opening a file outside of the root to fail")
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if fsRoot.fd >= 0 {
+		t.Error("Expected Close to release the handle on the root")
+	}
+}
+
+func TestApplyControllers(t *testing.T) {
+	if IsCgroup2UnifiedMode() {
+		t.Skip("cgroup v1 only")
+	}
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	root, err := getCgroupRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &CgroupConfig{
+		Path:        fmt.Sprintf("/test-controllers-%d", time.Now().Nanosecond()),
+		Controllers: []Controller{{Name: "freezer", Required: true}},
+		Resources:   &Resources{},
+	}
+	m := NewManager(config, nil, false)
+	defer m.Close()
+	if err := m.Apply(-1); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Destroy()
+	paths := m.GetPaths()
+	if len(paths) != 1 || paths["freezer"] == "" {
+		t.Fatalf("Expected to only join freezer, got %v", paths)
+	}
+	if cpu, err := FindCgroupMountpoint(root, "cpu"); err == nil && PathExists(filepath.Join(cpu, config.Path)) {
+		t.Errorf("Expected no cpu cgroup to be created")
+	}
+
+	// A required controller that is not mounted fails before anything
+	// is created.
+	if lookupRegistered(testPlugin{}.Name()) == nil {
+		if err := Register(testPlugin{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config = &CgroupConfig{
+		Path: fmt.Sprintf("/test-controllers-%d", time.Now().Nanosecond()),
+		Controllers: []Controller{
+			{Name: "freezer", Required: true},
+			{Name: testPlugin{}.Name(), Required: true},
+		},
+		Resources: &Resources{},
+	}
+	if err := NewManager(config, nil, false).Apply(-1); err == nil {
+		t.Fatal("Expected Apply to fail for a missing required controller")
+	}
+	if PathExists(filepath.Join(filepath.Dir(paths["freezer"]), config.Path)) {
+		t.Errorf("Expected no freezer cgroup to be created")
+	}
+
+	// An optional one is skipped.
+	config.Controllers[1].Required = false
+	m = NewManager(config, nil, false)
+	defer m.Close()
+	if err := m.Apply(-1); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Destroy()
+	if paths := m.GetPaths(); len(paths) != 1 || paths["freezer"] == "" {
+		t.Errorf("Expected to only join freezer, got %v", paths)
+	}
+}
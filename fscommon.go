@@ -3,41 +3,61 @@
 package cgroupManager
 
 import (
-	"bytes"
 	"fmt"
 	securejoin "github.com/cyphar/filepath-securejoin"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
-	"math"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
 )
 
-const (
-	cgroupfsDir    = "/sys/fs/cgroup"
-	cgroupfsPrefix = cgroupfsDir + "/"
-)
+const cgroupfsDir = "/sys/fs/cgroup"
 
 var (
 	TestMode          bool
-	cgroupFd          int = -1
-	prepOnce          sync.Once
-	prepErr           error
-	resolveFlags      uint64
 	ErrNotValidFormat = errors.New("line is not a valid key value format")
 )
 
-func prepareOpenat2() error {
-	prepOnce.Do(func() {
-		fd, err := unix.Openat2(-1, cgroupfsDir, &unix.OpenHow{
-			Flags: unix.O_DIRECTORY | unix.O_PATH})
+// cgroupfsRoot is a directory cgroup files are opened beneath with openat2.
+// Its handle is opened on first use, and released by close.
+type cgroupfsRoot struct {
+	dir          string
+	once         sync.Once
+	mu           sync.RWMutex
+	fd           int
+	resolveFlags uint64
+	err          error
+}
+
+// defaultCgroupfsRoot is the root of OpenFile, and of the managers not
+// given one.
+var defaultCgroupfsRoot = newCgroupfsRoot(cgroupfsDir)
+
+func newCgroupfsRoot(dir string) *cgroupfsRoot {
+	return &cgroupfsRoot{dir: dir, fd: -1}
+}
+
+// cgroupfsRootAt returns the root to open the files beneath dir with: the
+// default one if dir is empty or /sys/fs/cgroup, or a new one that must be
+// closed.
+func cgroupfsRootAt(dir string) *cgroupfsRoot {
+	if dir == "" || dir == cgroupfsDir {
+		return defaultCgroupfsRoot
+	}
+	return newCgroupfsRoot(dir)
+}
+
+func (r *cgroupfsRoot) prepareOpenat2() error {
+	r.once.Do(func() {
+		fd, err := unix.Openat2(-1, r.dir, &unix.OpenHow{
+			Flags: unix.O_DIRECTORY | unix.O_PATH | unix.O_CLOEXEC})
 		if err != nil {
-			prepErr = &os.PathError{Op: "openat2", Path: cgroupfsDir, Err: err}
+			r.err = &os.PathError{Op: "openat2", Path: r.dir, Err: err}
 			if err != unix.ENOSYS {
-				logrus.Warnf("falling back to securejoin: %s", prepErr)
+				logrus.Warnf("falling back to securejoin: %s", r.err)
 			} else {
 				logrus.Debug("openat2 not available, falling back to securejoin")
 			}
@@ -45,25 +65,48 @@ func prepareOpenat2() error {
 		}
 		var st unix.Statfs_t
 		if err = unix.Fstatfs(fd, &st); err != nil {
-			prepErr = &os.PathError{Op: "statfs", Path: cgroupfsDir, Err: err}
-			logrus.Warnf("falling back to securejoin: %s", prepErr)
+			unix.Close(fd)
+			r.err = &os.PathError{Op: "statfs", Path: r.dir, Err: err}
+			logrus.Warnf("falling back to securejoin: %s", r.err)
 			return
 		}
 
-		cgroupFd = fd
+		r.fd = fd
 
-		resolveFlags = unix.RESOLVE_BENEATH | unix.RESOLVE_NO_MAGICLINKS
+		r.resolveFlags = unix.RESOLVE_BENEATH | unix.RESOLVE_NO_MAGICLINKS
 		if st.Type == unix.CGROUP2_SUPER_MAGIC {
 			// cgroupv2 has a single mountpoint and no "cpu,cpuacct" symlinks
-			resolveFlags |= unix.RESOLVE_NO_XDEV | unix.RESOLVE_NO_SYMLINKS
+			r.resolveFlags |= unix.RESOLVE_NO_XDEV | unix.RESOLVE_NO_SYMLINKS
 		}
 
 	})
 
-	return prepErr
+	return r.err
 }
 
-func OpenFile(dir, file string, flags int) (*os.File, error) {
+// close releases the handle on the root. Files are opened with
+// securejoin from then on. The default root is never closed.
+func (r *cgroupfsRoot) close() {
+	if r == defaultCgroupfsRoot {
+		return
+	}
+	r.once.Do(func() {})
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fd >= 0 {
+		unix.Close(r.fd)
+		r.fd = -1
+	}
+}
+
+// pathDir returns a cgroupDir without a handle, whose files are opened by
+// path beneath r.
+func (r *cgroupfsRoot) pathDir(path string) *cgroupDir {
+	return &cgroupDir{path: path, fd: -1, root: r}
+}
+
+// openFile is OpenFile, resolving dir beneath r instead of /sys/fs/cgroup.
+func (r *cgroupfsRoot) openFile(dir, file string, flags int) (*os.File, error) {
 	if dir == "" {
 		return nil, errors.Errorf("no directory specified for %s", file)
 	}
@@ -71,18 +114,20 @@ func OpenFile(dir, file string, flags int) (*os.File, error) {
 	if TestMode && flags&os.O_WRONLY != 0 {
 		flags |= os.O_TRUNC | os.O_CREATE
 	}
-	reldir := strings.TrimPrefix(dir, cgroupfsPrefix)
-	if len(reldir) == len(dir) {
+	reldir := strings.TrimPrefix(dir, r.dir+"/")
+	if len(reldir) == len(dir) || r.prepareOpenat2() != nil {
 		return openWithSecureJoin(dir, file, flags, mode)
 	}
-	if prepareOpenat2() != nil {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.fd < 0 {
 		return openWithSecureJoin(dir, file, flags, mode)
 	}
-
 	relname := reldir + "/" + file
-	fd, err := unix.Openat2(cgroupFd, relname,
+	fd, err := unix.Openat2(r.fd, relname,
 		&unix.OpenHow{
-			Resolve: resolveFlags,
+			Resolve: r.resolveFlags,
 			Flags:   uint64(flags) | unix.O_CLOEXEC,
 			Mode:    uint64(mode),
 		})
@@ -90,7 +135,11 @@ func OpenFile(dir, file string, flags int) (*os.File, error) {
 		return nil, &os.PathError{Op: "openat2", Path: dir + "/" + file, Err: err}
 	}
 
-	return os.NewFile(uintptr(fd), cgroupfsPrefix+relname), nil
+	return os.NewFile(uintptr(fd), r.dir+"/"+relname), nil
+}
+
+func OpenFile(dir, file string, flags int) (*os.File, error) {
+	return defaultCgroupfsRoot.openFile(dir, file, flags)
 }
 
 func openWithSecureJoin(dir, file string, flags int, mode os.FileMode) (*os.File, error) {
@@ -105,28 +154,13 @@ func openWithSecureJoin(dir, file string, flags int, mode os.FileMode) (*os.File
 // WriteFile writes data to a cgroup file in dir.
 // It is supposed to be used for cgroup files only.
 func WriteFile(dir, file, data string) error {
-	fd, err := OpenFile(dir, file, unix.O_WRONLY)
-	if err != nil {
-		return err
-	}
-	defer fd.Close()
-	if err := retryingWriteFile(fd, data); err != nil {
-		return errors.Wrapf(err, "failed to write %q", data)
-	}
-	return nil
+	return pathDir(dir).writeFile(file, data)
 }
 
 // ReadFile reads data from a cgroup file in dir.
 // It is supposed to be used for cgroup files only.
 func ReadFile(dir, file string) (string, error) {
-	fd, err := OpenFile(dir, file, unix.O_RDONLY)
-	if err != nil {
-		return "", err
-	}
-	var buf bytes.Buffer
-
-	_, err = buf.ReadFrom(fd)
-	return buf.String(), err
+	return pathDir(dir).readFile(file)
 }
 
 func retryingWriteFile(fd *os.File, data string) error {
@@ -182,28 +216,16 @@ func GetCgroupParamKeyValue(t string) (string, uint64, error) {
 // GetCgroupParamUint reads a single uint64 value from the specified cgroup file.
 // If the value read is "max", the math.MaxUint64 is returned.
 func GetCgroupParamUint(path, file string) (uint64, error) {
-	contents, err := GetCgroupParamString(path, file)
-	if err != nil {
-		return 0, err
-	}
-	contents = strings.TrimSpace(contents)
-	if contents == "max" {
-		return math.MaxUint64, nil
-	}
+	return pathDir(path).paramUint(file)
+}
 
-	res, err := ParseUint(contents, 10, 64)
-	if err != nil {
-		return res, fmt.Errorf("unable to parse file %q", path+"/"+file)
-	}
-	return res, nil
+// GetCgroupParamInt reads a single int64 value from the specified cgroup file.
+// If the value read is "max", the math.MaxInt64 is returned.
+func GetCgroupParamInt(path, file string) (int64, error) {
+	return pathDir(path).paramInt(file)
 }
 
 // GetCgroupParamString reads a string from the specified cgroup file.
 func GetCgroupParamString(path, file string) (string, error) {
-	contents, err := ReadFile(path, file)
-	if err != nil {
-		return "", err
-	}
-
-	return strings.TrimSpace(contents), nil
+	return pathDir(path).paramString(file)
 }
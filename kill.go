@@ -0,0 +1,219 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const cgroupKill = "cgroup.kill"
+
+// DestroyWithKill kills every process in the cgroup and then removes it.
+// The processes are frozen while they are being killed, so that they can not
+// fork new ones. Where the kernel provides cgroup.kill, it is used instead.
+func (m *manager) DestroyWithKill() error {
+	if m.cgroups == nil || m.cgroups.Paths != nil {
+		return nil
+	}
+	if err := m.killAll(); err != nil {
+		return err
+	}
+	if err := m.waitEmpty(); err != nil {
+		return err
+	}
+	return m.Destroy()
+}
+
+// killAll kills every process in the cgroup and its descendants, with
+// cgroup.kill where the kernel provides it and by signalling them with the
+// cgroup frozen otherwise. Frozen processes only die once thawed, so the
+// freezer is always thawed afterwards, even if the cgroup was frozen to
+// begin with, e.g. by PauseFor.
+func (m *manager) killAll() error {
+	freezer := m.Path("freezer") != ""
+	ok, err := m.writeKill()
+	if !ok {
+		if freezer {
+			if err := m.Freeze(Frozen); err != nil {
+				return err
+			}
+		}
+		err = m.signalAll(unix.SIGKILL, true)
+	}
+	if freezer {
+		if terr := m.Freeze(Thawed); terr != nil && err == nil {
+			err = terr
+		}
+	}
+	return err
+}
+
+// writeKill writes to the cgroup.kill file of the first of the manager's
+// cgroups that has one, and reports whether it found one.
+func (m *manager) writeKill() (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, path := range m.paths {
+		if PathExists(filepath.Join(path, cgroupKill)) {
+			return true, m.dir(name).writeFile(cgroupKill, "1")
+		}
+	}
+	return false, nil
+}
+
+// SignalError lists the processes a signal could not be delivered to.
+type SignalError struct {
+	Signal unix.Signal
+	Failed map[int]error
+}
+
+func (e *SignalError) Error() string {
+	pids := make([]int, 0, len(e.Failed))
+	for pid := range e.Failed {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+	msgs := make([]string, 0, len(pids))
+	for _, pid := range pids {
+		msgs = append(msgs, fmt.Sprintf("%d: %v", pid, e.Failed[pid]))
+	}
+	return fmt.Sprintf("failed to send %s to %s", unix.SignalName(e.Signal), strings.Join(msgs, ", "))
+}
+
+// Signal sends sig to every process in the cgroup, and in its descendants
+// if recursive is set. The cgroup is frozen while the processes are
+// enumerated and signalled, so that none can escape by forking, and thawed
+// again afterwards unless it was frozen to begin with. Processes that can
+// not be signalled are reported through a *SignalError.
+func (m *manager) Signal(sig unix.Signal, recursive bool) error {
+	thaw := false
+	if m.Path("freezer") != "" {
+		state, err := m.GetFreezerState()
+		if err != nil {
+			return err
+		}
+		if state != Frozen {
+			if err := m.Freeze(Frozen); err != nil {
+				return err
+			}
+			thaw = true
+		}
+	}
+
+	err := m.signalAll(sig, recursive)
+	// Frozen processes only handle the signal once thawed.
+	if thaw {
+		if terr := m.Freeze(Thawed); terr != nil && err == nil {
+			err = terr
+		}
+	}
+	return err
+}
+
+func (m *manager) signalAll(sig unix.Signal, recursive bool) error {
+	var (
+		pids []int
+		err  error
+	)
+	if recursive {
+		pids, err = m.allPids()
+	} else {
+		pids, err = m.pids()
+	}
+	if err != nil {
+		return err
+	}
+
+	failed := make(map[int]error)
+	for _, pid := range pids {
+		if err := signalPid(pid, sig); err != nil {
+			failed[pid] = err
+		}
+	}
+	if len(failed) > 0 {
+		return &SignalError{Signal: sig, Failed: failed}
+	}
+	return nil
+}
+
+// signalPid sends sig to pid through a pidfd, so that the signal can not
+// reach another process that reused the pid. Processes that are already
+// gone are not an error.
+func signalPid(pid int, sig unix.Signal) error {
+	fd, err := unix.PidfdOpen(pid, 0)
+	if err == unix.ENOSYS {
+		err = unix.Kill(pid, sig)
+		if err == unix.ESRCH {
+			return nil
+		}
+		return os.NewSyscallError("kill", err)
+	}
+	if err != nil {
+		if err == unix.ESRCH {
+			return nil
+		}
+		return os.NewSyscallError("pidfd_open", err)
+	}
+	defer unix.Close(fd)
+
+	if err := unix.PidfdSendSignal(fd, sig, nil, 0); err != nil && err != unix.ESRCH {
+		return os.NewSyscallError("pidfd_send_signal", err)
+	}
+	return nil
+}
+
+// pids returns the processes directly in any of the manager's paths.
+func (m *manager) pids() ([]int, error) {
+	return collectPids(m.GetPaths(), GetPids)
+}
+
+// allPids returns the processes found below any of the manager's paths.
+func (m *manager) allPids() ([]int, error) {
+	return collectPids(m.GetPaths(), GetAllPids)
+}
+
+// collectPids returns the union of the ids get finds in each of paths.
+func collectPids(paths map[string]string, get func(string) ([]int, error)) ([]int, error) {
+	seen := make(map[int]bool)
+	var pids []int
+	for _, path := range paths {
+		if !PathExists(path) {
+			continue
+		}
+		p, err := get(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, pid := range p {
+			if !seen[pid] {
+				seen[pid] = true
+				pids = append(pids, pid)
+			}
+		}
+	}
+	return pids, nil
+}
+
+func (m *manager) waitEmpty() error {
+	const retries = 10
+	delay := 10 * time.Millisecond
+	for i := 0; i < retries; i++ {
+		pids, err := m.allPids()
+		if err != nil {
+			return err
+		}
+		if len(pids) == 0 {
+			return nil
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+	return fmt.Errorf("cgroup still has processes after kill")
+}
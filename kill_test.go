@@ -0,0 +1,135 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestDestroyWithKill(t *testing.T) {
+	if IsCgroup2UnifiedMode() {
+		t.Skip("cgroup v2 is not supported")
+	}
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+
+	cmd := exec.Command("sleep", "60")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+	go cmd.Wait()
+
+	config := &CgroupConfig{
+		Path:      fmt.Sprintf("/test-kill-%d", time.Now().Nanosecond()),
+		Resources: &Resources{},
+	}
+	m := NewManager(config, nil, false)
+	defer m.Close()
+	if err := m.Apply(cmd.Process.Pid); err != nil {
+		t.Skip(err)
+	}
+	if err := m.DestroyWithKill(); err != nil {
+		m.Destroy()
+		t.Fatal(err)
+	}
+	for name, path := range m.GetPaths() {
+		if PathExists(path) {
+			t.Errorf("DestroyWithKill: %s cgroup %s still exists", name, path)
+		}
+	}
+}
+
+func TestDestroyWithKillFrozen(t *testing.T) {
+	if IsCgroup2UnifiedMode() {
+		t.Skip("cgroup v2 is not supported")
+	}
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+
+	cmd := exec.Command("sleep", "60")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+	go cmd.Wait()
+
+	config := &CgroupConfig{
+		Path:      fmt.Sprintf("/test-kill-frozen-%d", time.Now().Nanosecond()),
+		Resources: &Resources{},
+	}
+	m := NewManager(config, nil, false)
+	defer m.Close()
+	if err := m.Apply(cmd.Process.Pid); err != nil {
+		t.Skip(err)
+	}
+	if m.Path("freezer") == "" {
+		m.Destroy()
+		t.Skip("freezer cgroup not available")
+	}
+	lease, err := m.PauseFor(time.Minute)
+	if err != nil {
+		m.Destroy()
+		t.Fatal(err)
+	}
+	defer lease.Cancel()
+
+	if err := m.DestroyWithKill(); err != nil {
+		m.Freeze(Thawed)
+		m.Destroy()
+		t.Fatal(err)
+	}
+	for name, path := range m.GetPaths() {
+		if PathExists(path) {
+			t.Errorf("DestroyWithKill: %s cgroup %s still exists", name, path)
+		}
+	}
+}
+
+func TestSignal(t *testing.T) {
+	if IsCgroup2UnifiedMode() {
+		t.Skip("cgroup v2 is not supported")
+	}
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+
+	cmd := exec.Command("sleep", "60")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+
+	config := &CgroupConfig{
+		Path:      fmt.Sprintf("/test-signal-%d", time.Now().Nanosecond()),
+		Resources: &Resources{},
+	}
+	m := NewManager(config, nil, false)
+	defer m.Close()
+	if err := m.Apply(cmd.Process.Pid); err != nil {
+		t.Skip(err)
+	}
+	defer m.Destroy()
+
+	if err := m.Signal(unix.SIGTERM, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Wait(); err == nil {
+		t.Fatal("Expected sleep to be terminated by SIGTERM")
+	}
+	state, err := m.GetFreezerState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != Thawed {
+		t.Errorf("Expected cgroup to be thawed after Signal, got %q", state)
+	}
+}
@@ -0,0 +1,104 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"fmt"
+	"sort"
+
+	"golang.org/x/sys/unix"
+)
+
+// migrateRounds bounds how often MigrateAll re-reads the source cgroups
+// looking for processes that appeared while it was moving the others.
+const migrateRounds = 10
+
+// MigrateAll moves every process in src into dst. The source is frozen for
+// the duration, so that processes can not fork behind our back, and the
+// freezer is always the last hierarchy a process is moved in, so that it
+// stays frozen until it has been moved everywhere else. Processes that exit
+// during the migration are skipped.
+func MigrateAll(src, dst Manager) error {
+	thaw := false
+	if src.Path("freezer") != "" {
+		state, err := src.GetFreezerState()
+		if err != nil {
+			return err
+		}
+		if state != Frozen {
+			if err := src.Freeze(Frozen); err != nil {
+				return err
+			}
+			thaw = true
+		}
+	}
+
+	err := migrateAll(src, dst)
+	if thaw {
+		if terr := src.Freeze(Thawed); terr != nil && err == nil {
+			err = terr
+		}
+	}
+	return err
+}
+
+func migrateAll(src, dst Manager) error {
+	// Only look for processes in hierarchies we can move them out of.
+	dstPaths := dst.GetPaths()
+	srcPaths := make(map[string]string)
+	for name, path := range src.GetPaths() {
+		if _, ok := dstPaths[name]; ok {
+			srcPaths[name] = path
+		}
+	}
+
+	ordered := migrationOrder(dstPaths)
+	for i := 0; i < migrateRounds; i++ {
+		pids, err := collectPids(srcPaths, GetPids)
+		if err != nil {
+			return err
+		}
+		if len(pids) == 0 {
+			return nil
+		}
+		for _, pid := range pids {
+			if err := migratePid(pid, ordered); err != nil {
+				return err
+			}
+		}
+	}
+	return fmt.Errorf("processes are still left in source cgroup after %d rounds", migrateRounds)
+}
+
+// migrationOrder returns the paths with the freezer hierarchy last.
+func migrationOrder(paths map[string]string) []string {
+	names := make([]string, 0, len(paths))
+	for name := range paths {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if (names[i] == "freezer") != (names[j] == "freezer") {
+			return names[j] == "freezer"
+		}
+		return names[i] < names[j]
+	})
+	ordered := make([]string, 0, len(names))
+	for _, name := range names {
+		ordered = append(ordered, paths[name])
+	}
+	return ordered
+}
+
+func migratePid(pid int, paths []string) error {
+	for _, path := range paths {
+		if err := WriteCgroupProc(path, pid); err != nil {
+			// WriteCgroupProc already retried on EINVAL; if the process
+			// is gone now, there is nothing left to move.
+			if unix.Kill(pid, 0) == unix.ESRCH {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestMigrateAll(t *testing.T) {
+	if IsCgroup2UnifiedMode() {
+		t.Skip("cgroup v2 is not supported")
+	}
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+
+	cmd := exec.Command("sleep", "60")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	suffix := time.Now().Nanosecond()
+	src := NewManager(&CgroupConfig{
+		Path:      fmt.Sprintf("/test-migrate-src-%d", suffix),
+		Resources: &Resources{},
+	}, nil, false)
+	defer src.Close()
+	if err := src.Apply(cmd.Process.Pid); err != nil {
+		t.Skip(err)
+	}
+	defer src.Destroy()
+	dst := NewManager(&CgroupConfig{
+		Path:      fmt.Sprintf("/test-migrate-dst-%d", suffix),
+		Resources: &Resources{},
+	}, nil, false)
+	defer dst.Close()
+	if err := dst.Apply(-1); err != nil {
+		t.Fatal(err)
+	}
+	defer dst.DestroyWithKill()
+
+	if err := MigrateAll(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	for name, path := range dst.GetPaths() {
+		pids, err := GetPids(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pids) != 1 || pids[0] != cmd.Process.Pid {
+			t.Errorf("Expected %s cgroup to hold [%d], got %v", name, cmd.Process.Pid, pids)
+		}
+	}
+	state, err := src.GetFreezerState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != Thawed {
+		t.Errorf("Expected source to be thawed, got %q", state)
+	}
+}
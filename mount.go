@@ -0,0 +1,248 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// MountOptions configures MountCgroupfs.
+type MountOptions struct {
+	// ReadOnly mounts the hierarchies, and the tmpfs holding them,
+	// read-only.
+	ReadOnly bool
+	// OwnSubtree only exposes the cgroup the calling process is in, and
+	// its descendants, as the root of every hierarchy.
+	OwnSubtree bool
+}
+
+const cgroupfsMountFlags = unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC
+
+// MountCgroupfs mounts the cgroup hierarchies of the host at target, the way
+// they are laid out under /sys/fs/cgroup: on cgroup v1, a tmpfs holding one
+// mount per hierarchy, named after its controllers, with symlinks for the
+// co-mounted ones (e.g. cpu -> cpu,cpuacct) and the unified hierarchy of a
+// hybrid host; on cgroup v2, a single mount.
+//
+// The hierarchies are opened before anything is mounted, so target may be
+// /sys/fs/cgroup itself. If a mount fails, the ones already made are
+// unmounted again.
+//
+// The mounts are made in the mount namespace of the calling thread, so this
+// is meant to be called with the OS thread locked, after unshare(CLONE_NEWNS)
+// or in a child started with one; see MountCgroupfsInNamespace to mount in
+// another namespace. target must exist.
+func MountCgroupfs(target string, opts MountOptions) (err error) {
+	var mounted []string
+	defer func() {
+		if err != nil {
+			for i := len(mounted) - 1; i >= 0; i-- {
+				_ = unix.Unmount(mounted[i], unix.MNT_DETACH)
+			}
+		}
+	}()
+
+	if IsCgroup2UnifiedMode() {
+		src, err := openCgroupfsSource(unifiedMountpoint, opts.OwnSubtree)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		return bindCgroupfs(src, target, opts.ReadOnly, &mounted)
+	}
+
+	mounts, err := GetCgroupMounts(false)
+	if err != nil {
+		return err
+	}
+	srcs := make([]*os.File, 0, len(mounts)+1)
+	defer func() {
+		for _, src := range srcs {
+			src.Close()
+		}
+	}()
+	for _, m := range mounts {
+		src, err := openCgroupfsSource(m.Mountpoint, opts.OwnSubtree)
+		if err != nil {
+			return err
+		}
+		srcs = append(srcs, src)
+	}
+	var unified *os.File
+	if IsCgroup2HybridMode() {
+		if unified, err = openCgroupfsSource(hybridMountpoint, opts.OwnSubtree); err != nil {
+			return err
+		}
+		srcs = append(srcs, unified)
+	}
+
+	if err := unix.Mount("tmpfs", target, "tmpfs", cgroupfsMountFlags, "mode=755"); err != nil {
+		return &os.PathError{Op: "mount", Path: target, Err: err}
+	}
+	mounted = append(mounted, target)
+	for i, m := range mounts {
+		name := filepath.Base(m.Mountpoint)
+		dst := filepath.Join(target, name)
+		if err := os.Mkdir(dst, 0755); err != nil {
+			return err
+		}
+		if err := bindCgroupfs(srcs[i], dst, opts.ReadOnly, &mounted); err != nil {
+			return err
+		}
+		for _, ss := range m.Subsystems {
+			if ss == name {
+				continue
+			}
+			if err := os.Symlink(name, filepath.Join(target, ss)); err != nil && !os.IsExist(err) {
+				return err
+			}
+		}
+	}
+	if unified != nil {
+		dst := filepath.Join(target, UnifiedHierarchy)
+		if err := os.Mkdir(dst, 0755); err != nil {
+			return err
+		}
+		if err := bindCgroupfs(unified, dst, opts.ReadOnly, &mounted); err != nil {
+			return err
+		}
+	}
+
+	if opts.ReadOnly {
+		flags := uintptr(unix.MS_REMOUNT | unix.MS_RDONLY | cgroupfsMountFlags)
+		if err := unix.Mount("tmpfs", target, "tmpfs", flags, "mode=755"); err != nil {
+			return &os.PathError{Op: "remount", Path: target, Err: err}
+		}
+	}
+	return nil
+}
+
+// MountCgroupfsInNamespace is MountCgroupfs in the mount namespace nsFd
+// refers to, e.g. an open /proc/<pid>/ns/mnt. It joins the namespace on a
+// locked OS thread of its own, which exits once done instead of going back
+// to the runtime in the other namespace.
+func MountCgroupfsInNamespace(nsFd int, target string, opts MountOptions) error {
+	errCh := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		// setns(CLONE_NEWNS) fails for threads sharing their filesystem
+		// attributes, as the threads of the runtime do.
+		if err := unix.Unshare(unix.CLONE_FS); err != nil {
+			errCh <- os.NewSyscallError("unshare", err)
+			return
+		}
+		if err := unix.Setns(nsFd, unix.CLONE_NEWNS); err != nil {
+			errCh <- os.NewSyscallError("setns", err)
+			return
+		}
+		errCh <- MountCgroupfs(target, opts)
+	}()
+	return <-errCh
+}
+
+// openCgroupfsSource opens the directory MountCgroupfs binds for the
+// hierarchy mounted at mountpoint, see ownSubtree.
+func openCgroupfsSource(mountpoint string, own bool) (*os.File, error) {
+	src, err := ownSubtree(mountpoint, own)
+	if err != nil {
+		return nil, err
+	}
+	return os.OpenFile(src, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+}
+
+// bindCgroupfs bind mounts the cgroup directory src, opened by
+// openCgroupfsSource, at dst, and adds dst to mounted.
+func bindCgroupfs(src *os.File, dst string, readOnly bool, mounted *[]string) error {
+	// The mount follows the magic link to the directory src was opened
+	// on, even if its path is hidden by now.
+	srcPath := fmt.Sprintf("/proc/self/fd/%d", src.Fd())
+	if err := unix.Mount(srcPath, dst, "", unix.MS_BIND, ""); err != nil {
+		return &os.PathError{Op: "bind mount", Path: dst, Err: err}
+	}
+	*mounted = append(*mounted, dst)
+	flags := uintptr(unix.MS_BIND | unix.MS_REMOUNT | cgroupfsMountFlags)
+	if readOnly {
+		flags |= unix.MS_RDONLY
+	}
+	if err := unix.Mount("", dst, "", flags, ""); err != nil {
+		return &os.PathError{Op: "remount", Path: dst, Err: err}
+	}
+	return nil
+}
+
+// ownSubtree returns the directory of the calling process's cgroup in the
+// hierarchy mounted at mountpoint, or mountpoint itself if own is false.
+func ownSubtree(mountpoint string, own bool) (string, error) {
+	if !own {
+		return mountpoint, nil
+	}
+	snap, err := getMountSnapshot()
+	if err != nil {
+		return "", err
+	}
+	mnt, err := findMount(snap.mountinfo, mountpoint)
+	if err != nil {
+		return "", err
+	}
+
+	var cgroup string
+	var ok bool
+	if mnt.fstype == "cgroup2" {
+		cgroup, ok = snap.controllers[""]
+	} else {
+		// Any controller of the hierarchy will do, they all share the
+		// same cgroup.
+		for _, opt := range strings.Split(mnt.options, ",") {
+			if cgroup, ok = snap.controllers[opt]; ok {
+				break
+			}
+		}
+	}
+	if !ok {
+		return "", NewNotFoundError(mountpoint)
+	}
+
+	return mountedCgroupPath(mountpoint, mnt.root, cgroup)
+}
+
+type mountEntry struct {
+	dev     string
+	root    string
+	fstype  string
+	options string
+}
+
+// findMount returns the last entry of mountinfo mounted at mountpoint, the
+// one that is visible.
+func findMount(mountinfo []byte, mountpoint string) (*mountEntry, error) {
+	var found *mountEntry
+	scanner := bufio.NewScanner(bytes.NewReader(mountinfo))
+	for scanner.Scan() {
+		txt := scanner.Text()
+		fields := strings.Split(txt, " ")
+		index := strings.Index(txt, " - ")
+		if index == -1 || len(fields) < 5 || fields[4] != mountpoint {
+			continue
+		}
+		post := strings.Fields(txt[index+3:])
+		if len(post) < 3 {
+			continue
+		}
+		found = &mountEntry{dev: fields[2], root: fields[3], fstype: post[0], options: post[2]}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, NewNotFoundError(mountpoint)
+	}
+	return found, nil
+}
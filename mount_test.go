@@ -0,0 +1,211 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestMountCgroupfs(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	dir, err := ioutil.TempDir("", "cgroupfs_mount_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	errCh := make(chan error, 1)
+	go func() {
+		// The thread is only unlocked once it is back in our own mount
+		// namespace, otherwise it exits with the goroutine.
+		runtime.LockOSThread()
+		ns, err := unix.Open("/proc/thread-self/ns/mnt", unix.O_RDONLY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			runtime.UnlockOSThread()
+			errCh <- err
+			return
+		}
+		defer unix.Close(ns)
+		if err := unix.Unshare(unix.CLONE_NEWNS); err != nil {
+			runtime.UnlockOSThread()
+			errCh <- err
+			return
+		}
+		err = unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, "")
+		if err == nil {
+			err = checkMountCgroupfs(dir)
+		}
+		if unix.Setns(ns, unix.CLONE_NEWNS) == nil {
+			runtime.UnlockOSThread()
+		}
+		errCh <- err
+	}()
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing may leak into our own mount namespace.
+	if _, err := os.Stat(filepath.Join(dir, CgroupProcesses)); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be empty outside of the mount namespace", dir)
+	}
+}
+
+func checkMountCgroupfs(dir string) error {
+	if err := MountCgroupfs(dir, MountOptions{ReadOnly: true, OwnSubtree: true}); err != nil {
+		return err
+	}
+
+	var hierarchies []string
+	if IsCgroup2UnifiedMode() {
+		hierarchies = append(hierarchies, dir)
+	} else {
+		mounts, err := GetCgroupMounts(false)
+		if err != nil {
+			return err
+		}
+		for _, m := range mounts {
+			name := filepath.Base(m.Mountpoint)
+			hierarchies = append(hierarchies, filepath.Join(dir, name))
+			for _, ss := range m.Subsystems {
+				if ss == name {
+					continue
+				}
+				if link, err := os.Readlink(filepath.Join(dir, ss)); err != nil || link != name {
+					return &os.PathError{Op: "readlink", Path: filepath.Join(dir, ss), Err: os.ErrNotExist}
+				}
+			}
+		}
+		if IsCgroup2HybridMode() {
+			hierarchies = append(hierarchies, filepath.Join(dir, UnifiedHierarchy))
+		}
+	}
+
+	for _, h := range hierarchies {
+		pids, err := GetPids(h)
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, pid := range pids {
+			if pid == os.Getpid() {
+				found = true
+			}
+		}
+		if !found {
+			return &os.PathError{Op: "find own pid", Path: h, Err: os.ErrNotExist}
+		}
+		if err := unix.Mkdir(filepath.Join(h, "test-mount-ro"), 0755); err != unix.EROFS {
+			return &os.PathError{Op: "mkdir", Path: h, Err: err}
+		}
+	}
+	if err := unix.Mkdir(filepath.Join(dir, "test-mount-ro"), 0755); err != unix.EROFS && !IsCgroup2UnifiedMode() {
+		return &os.PathError{Op: "mkdir", Path: dir, Err: err}
+	}
+	return nil
+}
+
+func TestMountCgroupfsInNamespace(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+
+	// Make a private mount namespace to mount in, keeping our own.
+	type nsResult struct {
+		fd  int
+		err error
+	}
+	nsCh := make(chan nsResult, 1)
+	go func() {
+		// As in TestMountCgroupfs, the thread is only unlocked once it is
+		// back in our own mount namespace.
+		runtime.LockOSThread()
+		own, err := unix.Open("/proc/thread-self/ns/mnt", unix.O_RDONLY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			runtime.UnlockOSThread()
+			nsCh <- nsResult{err: err}
+			return
+		}
+		defer unix.Close(own)
+		if err := unix.Unshare(unix.CLONE_NEWNS); err != nil {
+			runtime.UnlockOSThread()
+			nsCh <- nsResult{err: err}
+			return
+		}
+		var fd int
+		err = unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, "")
+		if err == nil {
+			fd, err = unix.Open("/proc/thread-self/ns/mnt", unix.O_RDONLY|unix.O_CLOEXEC, 0)
+		}
+		if unix.Setns(own, unix.CLONE_NEWNS) == nil {
+			runtime.UnlockOSThread()
+		}
+		nsCh <- nsResult{fd: fd, err: err}
+	}()
+	ns := <-nsCh
+	if ns.err != nil {
+		t.Fatal(ns.err)
+	}
+	defer unix.Close(ns.fd)
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	before, err := ioutil.ReadFile("/proc/thread-self/mountinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Mounting over the hierarchies themselves must work.
+	if err := MountCgroupfsInNamespace(ns.fd, cgroupfsDir, MountOptions{ReadOnly: true, OwnSubtree: true}); err != nil {
+		t.Fatal(err)
+	}
+	after, err := ioutil.ReadFile("/proc/thread-self/mountinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(before) != string(after) {
+		t.Error("Expected no mounts to leak into our own mount namespace")
+	}
+
+	hierarchy := cgroupfsDir
+	if !IsCgroup2UnifiedMode() {
+		mounts, err := GetCgroupMounts(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hierarchy = filepath.Join(cgroupfsDir, filepath.Base(mounts[0].Mountpoint))
+	}
+	pidsCh := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		if err := unix.Unshare(unix.CLONE_FS); err != nil {
+			pidsCh <- err
+			return
+		}
+		if err := unix.Setns(ns.fd, unix.CLONE_NEWNS); err != nil {
+			pidsCh <- err
+			return
+		}
+		pids, err := readProcsFile(filepath.Join(hierarchy, CgroupProcesses))
+		if err != nil {
+			pidsCh <- err
+			return
+		}
+		for _, pid := range pids {
+			if pid == os.Getpid() {
+				pidsCh <- nil
+				return
+			}
+		}
+		pidsCh <- &os.PathError{Op: "find own pid", Path: hierarchy, Err: os.ErrNotExist}
+	}()
+	if err := <-pidsCh; err != nil {
+		t.Fatal(err)
+	}
+}
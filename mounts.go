@@ -0,0 +1,104 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// mountSnapshot is a parsed view of the mount table. gen changes every time
+// the snapshot is rebuilt.
+type mountSnapshot struct {
+	gen       uint64
+	mountinfo []byte
+	// controllers lists the hierarchies from /proc/self/cgroup. Only the
+	// keys are meant to be used: the paths are those of the moment the
+	// snapshot was taken.
+	controllers map[string]string
+}
+
+// mountCache keeps the mountinfo of the mount namespace of the calling
+// thread open and only rereads it when the kernel signals a change of the
+// mount table through POLLPRI, or when called from another mount namespace.
+var mountCache struct {
+	sync.Mutex
+	f    *os.File
+	ns   uint64
+	snap *mountSnapshot
+	gen  uint64
+}
+
+// getMountSnapshot returns the current mount table, rereading it only if it
+// changed since the last call.
+func getMountSnapshot() (*mountSnapshot, error) {
+	mountCache.Lock()
+	defer mountCache.Unlock()
+
+	var st unix.Stat_t
+	if err := unix.Stat("/proc/thread-self/ns/mnt", &st); err != nil {
+		return nil, &os.PathError{Op: "stat", Path: "/proc/thread-self/ns/mnt", Err: err}
+	}
+	if mountCache.f != nil && mountCache.ns != st.Ino {
+		mountCache.f.Close()
+		mountCache.f = nil
+	}
+	if mountCache.f == nil {
+		// Not os.Open: the runtime would add the file to its epoll set,
+		// and the poller polling it would consume the POLLPRI we wait for.
+		fd, err := unix.Open("/proc/thread-self/mountinfo", unix.O_RDONLY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return nil, &os.PathError{Op: "open", Path: "/proc/thread-self/mountinfo", Err: err}
+		}
+		mountCache.f = os.NewFile(uintptr(fd), "/proc/thread-self/mountinfo")
+		mountCache.ns = st.Ino
+	} else if mountCache.snap != nil && !mountTableChanged(mountCache.f) {
+		return mountCache.snap, nil
+	}
+
+	mountinfo, err := readAll(mountCache.f)
+	if err != nil {
+		return nil, err
+	}
+	controllers, err := ParseCgroupFile("/proc/self/cgroup")
+	if err != nil {
+		return nil, err
+	}
+	mountCache.gen++
+	mountCache.snap = &mountSnapshot{
+		gen:         mountCache.gen,
+		mountinfo:   mountinfo,
+		controllers: controllers,
+	}
+	return mountCache.snap, nil
+}
+
+// mountTableChanged polls f, an open /proc/self/mountinfo, for a change of
+// the mount table since the previous poll. Errors are reported as a change,
+// so that the caller rereads the table rather than trusting a stale copy.
+func mountTableChanged(f *os.File) bool {
+	fds := []unix.PollFd{{Fd: int32(f.Fd()), Events: unix.POLLPRI}}
+	for {
+		n, err := unix.Poll(fds, 0)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return true
+		}
+		return n > 0 && fds[0].Revents&(unix.POLLPRI|unix.POLLERR) != 0
+	}
+}
+
+// readAll reads f from offset 0.
+func readAll(f *os.File) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(io.NewSectionReader(f, 0, 1<<62)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
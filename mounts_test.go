@@ -0,0 +1,43 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestMountSnapshotInvalidation(t *testing.T) {
+	first, err := getMountSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := getMountSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.gen != second.gen {
+		t.Fatalf("Expected cached snapshot, generation went from %d to %d", first.gen, second.gen)
+	}
+
+	dir, err := ioutil.TempDir("", "cgroup_mounts_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := unix.Mount("tmpfs", dir, "tmpfs", 0, ""); err != nil {
+		t.Skip(err)
+	}
+	defer unix.Unmount(dir, unix.MNT_DETACH)
+
+	third, err := getMountSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.gen == second.gen {
+		t.Error("Expected snapshot to be reread after a mount")
+	}
+}
@@ -0,0 +1,140 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultParamAllowlist is the allowlist of GetParam and SetParam for the
+// cgroups whose CgroupConfig has no ParamAllowlist.
+var defaultParamAllowlist = map[string][]string{
+	"cpu": {
+		"cpu.shares",
+		"cpu.cfs_period_us",
+		"cpu.cfs_quota_us",
+		"cpu.cfs_burst_us",
+		"cpu.rt_period_us",
+		"cpu.rt_runtime_us",
+		"cpu.idle",
+	},
+	"cpuset": {
+		"cpuset.cpus",
+		"cpuset.mems",
+		"cpuset.cpu_exclusive",
+		"cpuset.mem_exclusive",
+		"cpuset.memory_migrate",
+		"cpuset.sched_load_balance",
+	},
+	"cpuacct": {
+		"cpuacct.usage",
+	},
+	"freezer": {
+		"freezer.state",
+	},
+}
+
+// DefaultParamAllowlist returns a copy of the allowlist used for the
+// cgroups whose CgroupConfig has no ParamAllowlist, e.g. to extend it.
+func DefaultParamAllowlist() map[string][]string {
+	allowlist := make(map[string][]string, len(defaultParamAllowlist))
+	for controller, files := range defaultParamAllowlist {
+		allowlist[controller] = append([]string(nil), files...)
+	}
+	return allowlist
+}
+
+// paramAllowed returns an error unless file of controller is in the
+// allowlist of the manager.
+func (m *manager) paramAllowed(controller, file string) error {
+	allowlist := defaultParamAllowlist
+	if m.cgroups != nil && m.cgroups.ParamAllowlist != nil {
+		allowlist = m.cgroups.ParamAllowlist
+	}
+	for _, f := range allowlist[controller] {
+		if f == file {
+			return nil
+		}
+	}
+	return fmt.Errorf("cgroup: %s is not an allowed %s parameter", file, controller)
+}
+
+// GetParam returns the trimmed content of file in the cgroup of controller.
+// file must be allowed by the ParamAllowlist of the CgroupConfig.
+func (m *manager) GetParam(controller, file string) (string, error) {
+	if err := m.paramAllowed(controller, file); err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path := m.paths[controller]
+	if path == "" {
+		return "", fmt.Errorf("cannot get %s parameter %s: %v", controller, file, errNotJoined)
+	}
+	value, err := m.dir(controller).readFile(file)
+	return strings.TrimSpace(value), err
+}
+
+// SetParam writes value to file in the cgroup of controller. file must be
+// allowed by the ParamAllowlist of the CgroupConfig. The value is recorded,
+// and later calls to Set, SetTransactional and SetDiff leave the file
+// alone, even if their Resources have a setting for it, until ClearParam.
+func (m *manager) SetParam(controller, file, value string) error {
+	if err := m.paramAllowed(controller, file); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path := m.paths[controller]
+	if path == "" {
+		return fmt.Errorf("cannot set %s parameter %s: %v", controller, file, errNotJoined)
+	}
+	if err := m.dir(controller).writeFile(file, value); err != nil {
+		return err
+	}
+	if m.params == nil {
+		m.params = make(map[string]map[string]string)
+	}
+	if m.params[controller] == nil {
+		m.params[controller] = make(map[string]string)
+	}
+	m.params[controller][file] = value
+	return nil
+}
+
+// ClearParam forgets the value SetParam recorded for file in the cgroup of
+// controller, so that Set, SetTransactional and SetDiff write the file
+// again. The file itself is left as is.
+func (m *manager) ClearParam(controller, file string) error {
+	if err := m.paramAllowed(controller, file); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.params[controller], file)
+	if len(m.params[controller]) == 0 {
+		delete(m.params, controller)
+	}
+	return nil
+}
+
+// withParams returns container with the settings of the files recorded by
+// SetParam cleared, so that Set does not overwrite them. Must be called
+// with m.mu held.
+func (m *manager) withParams(container *Config) *Config {
+	if len(m.params) == 0 || container.Cgroups == nil || container.Cgroups.Resources == nil {
+		return container
+	}
+	r := *container.Cgroups.Resources
+	for _, files := range m.params {
+		for file := range files {
+			copySetting(&r, &Resources{}, file)
+		}
+	}
+	cg := *container.Cgroups
+	cg.Resources = &r
+	c := *container
+	c.Cgroups = &cg
+	return &c
+}
@@ -0,0 +1,107 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"testing"
+)
+
+func TestSetParamNotClobbered(t *testing.T) {
+	helper := NewCgroupTestUtil("cpu", t)
+	defer helper.cleanup()
+
+	helper.writeFileContents(map[string]string{
+		"cpu.shares":       "1024",
+		"cpu.cfs_quota_us": "-1",
+	})
+
+	m := NewManager(&CgroupConfig{Resources: &Resources{}}, map[string]string{"cpu": helper.CgroupPath}, false)
+	defer m.Close()
+
+	if err := m.SetParam("cpu", "cpu.shares", "256"); err != nil {
+		t.Fatal(err)
+	}
+	value, err := m.GetParam("cpu", "cpu.shares")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "256" {
+		t.Errorf("Expected cpu.shares to be 256, got %q", value)
+	}
+
+	config := &Config{Cgroups: &CgroupConfig{Resources: &Resources{
+		CpuShares: 512,
+		CpuQuota:  50000,
+	}}}
+	if err := m.Set(config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Cgroups.Resources.CpuShares != 512 {
+		t.Errorf("Set modified the caller's Resources")
+	}
+
+	shares, err := GetCgroupParamUint(helper.CgroupPath, "cpu.shares")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shares != 256 {
+		t.Errorf("Expected cpu.shares set by SetParam to be kept, got %d", shares)
+	}
+	quota, err := GetCgroupParamInt(helper.CgroupPath, "cpu.cfs_quota_us")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quota != 50000 {
+		t.Errorf("Expected cpu.cfs_quota_us to be 50000, got %d", quota)
+	}
+
+	// Once cleared, the file is Set's again.
+	if err := m.ClearParam("cpu", "cpu.shares"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Set(config); err != nil {
+		t.Fatal(err)
+	}
+	shares, err = GetCgroupParamUint(helper.CgroupPath, "cpu.shares")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shares != 512 {
+		t.Errorf("Expected cpu.shares to be set to 512 after ClearParam, got %d", shares)
+	}
+	if err := m.ClearParam("cpu", "cgroup.procs"); err == nil {
+		t.Error("Expected ClearParam of a file not in the allowlist to fail")
+	}
+}
+
+func TestParamAllowlist(t *testing.T) {
+	helper := NewCgroupTestUtil("cpu", t)
+	defer helper.cleanup()
+
+	m := NewManager(&CgroupConfig{Resources: &Resources{}}, map[string]string{"cpu": helper.CgroupPath}, false)
+	defer m.Close()
+
+	if err := m.SetParam("cpu", "cgroup.procs", "1"); err == nil {
+		t.Error("Expected SetParam of a file not in the allowlist to fail")
+	}
+	if _, err := m.GetParam("cpu", "../cpu.shares"); err == nil {
+		t.Error("Expected GetParam of a file not in the allowlist to fail")
+	}
+	if _, err := m.GetParam("memory", "memory.limit_in_bytes"); err == nil {
+		t.Error("Expected GetParam of a controller not in the allowlist to fail")
+	}
+
+	// A cgroup can have its own allowlist.
+	config := &CgroupConfig{
+		Resources:      &Resources{},
+		ParamAllowlist: map[string][]string{"cpu": {"cpu.weight"}},
+	}
+	m2 := NewManager(config, map[string]string{"cpu": helper.CgroupPath}, false)
+	defer m2.Close()
+	if err := m2.SetParam("cpu", "cpu.weight", "100"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m2.GetParam("cpu", "cpu.shares"); err == nil {
+		t.Error("Expected GetParam of a file only in the default allowlist to fail")
+	}
+}
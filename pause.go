@@ -0,0 +1,297 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// PauseLeaseDir is where pause leases are kept. It should be on a tmpfs, so
+// that leases do not outlive a reboot.
+var PauseLeaseDir = "/run/cgroupManager"
+
+// pauseWatcher thaws the cgroup once the expiry time stored in the lease
+// file ($1) has passed, by writing to its freezer.state ($2). Removing the
+// lease file stops the watcher without thawing.
+const pauseWatcher = `
+while [ -f "$1" ]; do
+	read expiry watcher < "$1" || expiry=0
+	if [ "$(date +%s)" -ge "$expiry" ]; then
+		rm -f "$1"
+		echo THAWED > "$2"
+		exit 0
+	fi
+	sleep 1
+done
+`
+
+// PauseLease is a time limited freeze of a cgroup, created by PauseFor.
+type PauseLease struct {
+	file        string
+	freezerPath string
+	watcher     int
+	// watcherStart is the start time of the watcher, which tells it apart
+	// from a process that reused its pid.
+	watcherStart uint64
+}
+
+// PauseFor freezes the cgroup and arranges for it to be thawed after d,
+// even if the calling process dies in the meantime. The thaw is done by a
+// detached watcher process polling a lease file. If the cgroup is already
+// paused, it is frozen again, in case it has been thawed since, and the
+// existing lease is extended instead.
+func (m *manager) PauseFor(d time.Duration) (*PauseLease, error) {
+	path := m.Path("freezer")
+	if m.cgroups == nil || path == "" {
+		return nil, errors.New("cannot pause: cgroups not configured for container")
+	}
+	if err := os.MkdirAll(PauseLeaseDir, 0700); err != nil {
+		return nil, err
+	}
+
+	l := &PauseLease{
+		file:        leaseFile(path),
+		freezerPath: path,
+	}
+	if expiry, pid, start, err := readLease(l.file); err == nil && time.Now().Before(expiry) && watcherAlive(pid, start) {
+		l.watcher, l.watcherStart = pid, start
+		if err := m.Freeze(Frozen); err != nil {
+			return nil, err
+		}
+		return l, l.Extend(d)
+	}
+
+	if err := m.Freeze(Frozen); err != nil {
+		return nil, err
+	}
+	// The lease must exist before the watcher starts, or it exits at once.
+	if err := l.write(time.Now().Add(d)); err != nil {
+		return nil, err
+	}
+	pid, start, err := startPauseWatcher(l.file, filepath.Join(path, "freezer.state"))
+	if err != nil {
+		os.Remove(l.file)
+		if terr := m.Freeze(Thawed); terr != nil {
+			logrus.WithError(terr).Warnf("failed to thaw %s", path)
+		}
+		return nil, err
+	}
+	l.watcher, l.watcherStart = pid, start
+	return l, l.write(time.Now().Add(d))
+}
+
+// Extend moves the expiry of the lease to d from now. If the watcher has
+// died, a new one is started, so that the cgroup is still thawed in time.
+func (l *PauseLease) Extend(d time.Duration) error {
+	if err := l.replace(time.Now().Add(d)); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("pause lease for %s has already expired", l.freezerPath)
+		}
+		return err
+	}
+	if watcherAlive(l.watcher, l.watcherStart) {
+		return nil
+	}
+	pid, start, err := startPauseWatcher(l.file, filepath.Join(l.freezerPath, "freezer.state"))
+	if err != nil {
+		return err
+	}
+	l.watcher, l.watcherStart = pid, start
+	return l.replace(time.Now().Add(d))
+}
+
+// Cancel stops the watcher and thaws the cgroup immediately.
+func (l *PauseLease) Cancel() error {
+	if err := os.Remove(l.file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := l.killWatcher(); err != nil {
+		return err
+	}
+	freezer := &FreezerGroup{}
+	return freezer.Set(l.freezerPath, &CgroupConfig{Resources: &Resources{Freezer: Thawed}})
+}
+
+// Expiry returns the time at which the cgroup will be thawed.
+func (l *PauseLease) Expiry() (time.Time, error) {
+	expiry, _, _, err := readLease(l.file)
+	return expiry, err
+}
+
+// killWatcher kills the watcher, if it is still running. The pidfd pins the
+// process, so checking its start time after opening it makes sure that it
+// is the watcher that is killed, and not a process that reused its pid.
+func (l *PauseLease) killWatcher() error {
+	if l.watcher <= 0 {
+		return nil
+	}
+	fd, err := unix.PidfdOpen(l.watcher, 0)
+	if err != nil {
+		if err == unix.ESRCH {
+			return nil
+		}
+		return os.NewSyscallError("pidfd_open", err)
+	}
+	defer unix.Close(fd)
+	if !watcherAlive(l.watcher, l.watcherStart) {
+		return nil
+	}
+	if err := unix.PidfdSendSignal(fd, unix.SIGKILL, nil, 0); err != nil && err != unix.ESRCH {
+		return os.NewSyscallError("pidfd_send_signal", err)
+	}
+	return nil
+}
+
+func (l *PauseLease) write(expiry time.Time) error {
+	tmp, err := l.writeTmp(expiry)
+	if err != nil {
+		return err
+	}
+	// Rename, so that the watcher never sees a partial lease.
+	return os.Rename(tmp, l.file)
+}
+
+// replace is like write, but fails with an error satisfying os.IsNotExist
+// if the lease no longer exists: checking for it separately would race
+// with the watcher removing it.
+func (l *PauseLease) replace(expiry time.Time) error {
+	tmp, err := l.writeTmp(expiry)
+	if err != nil {
+		return err
+	}
+	// Exchange rather than rename, which only succeeds if the lease is
+	// still there. tmp then holds the previous lease.
+	err = unix.Renameat2(unix.AT_FDCWD, tmp, unix.AT_FDCWD, l.file, unix.RENAME_EXCHANGE)
+	os.Remove(tmp)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: tmp, New: l.file, Err: err}
+	}
+	return nil
+}
+
+func (l *PauseLease) writeTmp(expiry time.Time) (string, error) {
+	// Round up, so that the cgroup is never thawed early.
+	secs := expiry.Unix()
+	if expiry.Nanosecond() > 0 {
+		secs++
+	}
+	// A temporary file of our own, next to the lease so that it can be
+	// renamed over it, as another process may be updating the same lease.
+	f, err := os.CreateTemp(filepath.Dir(l.file), filepath.Base(l.file)+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	_, err = fmt.Fprintf(f, "%d %d %d\n", secs, l.watcher, l.watcherStart)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func leaseFile(freezerPath string) string {
+	sum := sha256.Sum256([]byte(freezerPath))
+	return filepath.Join(PauseLeaseDir, hex.EncodeToString(sum[:8])+".lease")
+}
+
+// readLease returns the expiry of the lease in file, and the pid and start
+// time of its watcher.
+func readLease(file string) (time.Time, int, uint64, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return time.Time{}, 0, 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 3 {
+		return time.Time{}, 0, 0, fmt.Errorf("invalid pause lease %s", file)
+	}
+	secs, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return time.Time{}, 0, 0, err
+	}
+	pid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return time.Time{}, 0, 0, err
+	}
+	start, err := strconv.ParseUint(fields[2], 10, 64)
+	if err != nil {
+		return time.Time{}, 0, 0, err
+	}
+	return time.Unix(secs, 0), pid, start, nil
+}
+
+// watcherAlive reports whether the watcher pid, started at start, is still
+// running. A process with another start time has reused the pid. Zombies
+// count as dead, in case nobody reaps the reparented watcher.
+func watcherAlive(pid int, start uint64) bool {
+	if pid <= 0 {
+		return false
+	}
+	s, zombie, err := processStart(pid)
+	return err == nil && !zombie && s == start
+}
+
+// processStart returns the start time of pid, in clock ticks after boot, as
+// found in /proc/<pid>/stat, and whether it is a zombie.
+func processStart(pid int) (uint64, bool, error) {
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, false, err
+	}
+	// The command name may contain spaces and parentheses, the fields
+	// after it start with the state, the third one of the line.
+	i := strings.LastIndex(string(stat), ")")
+	if i < 0 {
+		return 0, false, fmt.Errorf("invalid /proc/%d/stat", pid)
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 20 {
+		return 0, false, fmt.Errorf("invalid /proc/%d/stat", pid)
+	}
+	start, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return start, fields[0] == "Z", nil
+}
+
+// startPauseWatcher runs the watcher in its own session and lets the
+// intermediate shell exit, so that the watcher is reparented and keeps
+// running when we exit. It returns the watcher's pid and start time. A
+// watcher that is already gone again gets a start time of 0, so that it
+// never counts as alive.
+func startPauseWatcher(lease, state string) (int, uint64, error) {
+	script := fmt.Sprintf("(%s) </dev/null >/dev/null 2>&1 &\necho $!", pauseWatcher)
+	cmd := exec.Command("/bin/sh", "-c", script, "sh", lease, state)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "failed to start pause watcher")
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		return 0, 0, err
+	}
+	start, _, err := processStart(pid)
+	if err != nil {
+		return pid, 0, nil
+	}
+	return pid, start, nil
+}
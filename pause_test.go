@@ -0,0 +1,223 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestPauseForThaws(t *testing.T) {
+	helper := NewCgroupTestUtil("freezer", t)
+	defer helper.cleanup()
+
+	helper.writeFileContents(map[string]string{
+		"freezer.state": string(Thawed),
+	})
+	defer func(dir string) { PauseLeaseDir = dir }(PauseLeaseDir)
+	PauseLeaseDir = helper.tempDir
+
+	paths := map[string]string{"freezer": helper.CgroupPath}
+	m := NewManager(&CgroupConfig{Resources: &Resources{}}, paths, false)
+	defer m.Close()
+	lease, err := m.PauseFor(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := GetCgroupParamString(helper.CgroupPath, "freezer.state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != string(Frozen) {
+		t.Fatalf("Expected cgroup to be frozen, got %q", state)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		state, err = GetCgroupParamString(helper.CgroupPath, "freezer.state")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state == string(Thawed) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if state != string(Thawed) {
+		t.Fatalf("Expected cgroup to be thawed after the lease expired, got %q", state)
+	}
+	if err := lease.Extend(time.Second); err == nil {
+		t.Error("Expected Extend to fail after the lease expired")
+	}
+}
+
+func TestPauseForCancel(t *testing.T) {
+	helper := NewCgroupTestUtil("freezer", t)
+	defer helper.cleanup()
+
+	helper.writeFileContents(map[string]string{
+		"freezer.state": string(Thawed),
+	})
+	defer func(dir string) { PauseLeaseDir = dir }(PauseLeaseDir)
+	PauseLeaseDir = helper.tempDir
+
+	paths := map[string]string{"freezer": helper.CgroupPath}
+	m := NewManager(&CgroupConfig{Resources: &Resources{}}, paths, false)
+	defer m.Close()
+	lease, err := m.PauseFor(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lease.Extend(2 * time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	expiry, err := lease.Expiry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expiry.Before(time.Now().Add(time.Hour)) {
+		t.Errorf("Expected lease to be extended, expires at %v", expiry)
+	}
+	if err := lease.Cancel(); err != nil {
+		t.Fatal(err)
+	}
+	state, err := GetCgroupParamString(helper.CgroupPath, "freezer.state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != string(Thawed) {
+		t.Errorf("Expected cgroup to be thawed after Cancel, got %q", state)
+	}
+}
+
+func TestPauseForCancelKillsWatcher(t *testing.T) {
+	helper := NewCgroupTestUtil("freezer", t)
+	defer helper.cleanup()
+
+	helper.writeFileContents(map[string]string{
+		"freezer.state": string(Thawed),
+	})
+	defer func(dir string) { PauseLeaseDir = dir }(PauseLeaseDir)
+	PauseLeaseDir = helper.tempDir
+
+	paths := map[string]string{"freezer": helper.CgroupPath}
+	m := NewManager(&CgroupConfig{Resources: &Resources{}}, paths, false)
+	defer m.Close()
+	lease, err := m.PauseFor(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !watcherAlive(lease.watcher, lease.watcherStart) {
+		t.Fatal("Expected the watcher to be running")
+	}
+	if err := lease.Cancel(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50 && watcherAlive(lease.watcher, lease.watcherStart); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if watcherAlive(lease.watcher, lease.watcherStart) {
+		t.Error("Expected Cancel to kill the watcher")
+	}
+	// The pid alone does not make a process the watcher.
+	if watcherAlive(os.Getpid(), lease.watcherStart) {
+		t.Error("Expected a process with another start time not to count as the watcher")
+	}
+}
+
+func TestPauseForRefreezes(t *testing.T) {
+	helper := NewCgroupTestUtil("freezer", t)
+	defer helper.cleanup()
+
+	helper.writeFileContents(map[string]string{
+		"freezer.state": string(Thawed),
+	})
+	defer func(dir string) { PauseLeaseDir = dir }(PauseLeaseDir)
+	PauseLeaseDir = helper.tempDir
+
+	paths := map[string]string{"freezer": helper.CgroupPath}
+	m := NewManager(&CgroupConfig{Resources: &Resources{}}, paths, false)
+	defer m.Close()
+	lease, err := m.PauseFor(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lease.Cancel()
+
+	// Thawed behind the lease's back.
+	if err := m.Freeze(Thawed); err != nil {
+		t.Fatal(err)
+	}
+	again, err := m.PauseFor(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.watcher != lease.watcher {
+		t.Errorf("Expected the existing lease to be reused")
+	}
+	state, err := GetCgroupParamString(helper.CgroupPath, "freezer.state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != string(Frozen) {
+		t.Errorf("Expected PauseFor to freeze the cgroup again, got %q", state)
+	}
+}
+
+func TestPauseLeaseExtendRestartsWatcher(t *testing.T) {
+	helper := NewCgroupTestUtil("freezer", t)
+	defer helper.cleanup()
+
+	helper.writeFileContents(map[string]string{
+		"freezer.state": string(Thawed),
+	})
+	defer func(dir string) { PauseLeaseDir = dir }(PauseLeaseDir)
+	PauseLeaseDir = helper.tempDir
+
+	paths := map[string]string{"freezer": helper.CgroupPath}
+	m := NewManager(&CgroupConfig{Resources: &Resources{}}, paths, false)
+	defer m.Close()
+	lease, err := m.PauseFor(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lease.Cancel()
+
+	old, oldStart := lease.watcher, lease.watcherStart
+	if err := unix.Kill(old, unix.SIGKILL); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50 && watcherAlive(old, oldStart); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := lease.Extend(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if lease.watcher == old || !watcherAlive(lease.watcher, lease.watcherStart) {
+		t.Fatal("Expected Extend to start a new watcher")
+	}
+	if _, pid, _, err := readLease(lease.file); err != nil || pid != lease.watcher {
+		t.Errorf("Expected the lease to name watcher %d, got %d (%v)", lease.watcher, pid, err)
+	}
+}
+
+func TestPauseLeaseExtendExpired(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pause_lease_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := &PauseLease{file: filepath.Join(dir, "test.lease"), freezerPath: dir}
+	if err := l.Extend(time.Second); err == nil {
+		t.Fatal("Expected Extend of a missing lease to fail")
+	}
+	if _, err := os.Stat(l.file); !os.IsNotExist(err) {
+		t.Errorf("Expected Extend not to create the lease, got %v", err)
+	}
+}
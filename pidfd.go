@@ -0,0 +1,182 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+var (
+	cloneIntoCgroupOnce sync.Once
+	cloneIntoCgroup     bool
+)
+
+// WriteCgroupProcPidfd moves the process referred to by pidfd into the
+// cgroup at dir. The pid is looked up from the pidfd and the process is
+// checked to still be alive before the pid is written, so that the pid of a
+// process that has exited, which may have been reused already, is never
+// written.
+func WriteCgroupProcPidfd(dir string, pidfd int) error {
+	return writeCgroupProcPidfd(pathDir(dir), pidfd)
+}
+
+func writeCgroupProcPidfd(d *cgroupDir, pidfd int) error {
+	pid, err := pidfdToPid(pidfd)
+	if err != nil {
+		return err
+	}
+	if err := unix.PidfdSendSignal(pidfd, 0, nil, 0); err != nil {
+		if err == unix.ESRCH {
+			return fmt.Errorf("process %d exited before being moved to %s", pid, d.path)
+		}
+		return os.NewSyscallError("pidfd_send_signal", err)
+	}
+	return writeCgroupID(d, CgroupProcesses, pid)
+}
+
+// pidfdToPid returns the pid of the process referred to by pidfd, as shown
+// in /proc/self/fdinfo.
+func pidfdToPid(pidfd int) (int, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/self/fdinfo/%d", pidfd))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		text := s.Text()
+		if !strings.HasPrefix(text, "Pid:") {
+			continue
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(text, "Pid:")))
+		if err != nil {
+			return 0, err
+		}
+		if pid <= 0 {
+			return 0, fmt.Errorf("process of pidfd %d has exited", pidfd)
+		}
+		return pid, nil
+	}
+	if err := s.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("fd %d is not a pidfd", pidfd)
+}
+
+// ApplyPidfd moves the process referred to by pidfd into all of the
+// manager's cgroups.
+func (m *manager) ApplyPidfd(pidfd int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, path := range m.paths {
+		d := m.dir(name)
+		if d.fd < 0 && !PathExists(path) {
+			continue
+		}
+		if err := writeCgroupProcPidfd(d, pidfd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartInCgroup starts cmd inside the manager's cgroups. If one of them is a
+// cgroup v2 directory and the kernel supports clone3 with CLONE_INTO_CGROUP,
+// the child is created directly in it, so that it never runs outside of it.
+// Otherwise, and for the remaining v1 hierarchies, the child is moved after
+// it has been started. As the child has not been waited for, its pid can
+// not have been reused at that point. If it can not be moved, it is killed
+// and waited for before the error is returned.
+func (m *manager) StartInCgroup(cmd *exec.Cmd) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var unified *cgroupDir
+	for name := range m.paths {
+		if d := m.dir(name); d.isCgroup2() {
+			unified = d
+			break
+		}
+	}
+
+	if unified != nil && cloneIntoCgroupSupported() {
+		if unified.fd < 0 {
+			d, err := openCgroupDir(m.fsRoot, unified.path)
+			if err != nil {
+				return err
+			}
+			defer d.close()
+			unified = d
+		}
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = unified.fd
+	} else {
+		unified = nil
+	}
+
+	err := cmd.Start()
+	runtime.KeepAlive(unified)
+	if err != nil {
+		return err
+	}
+	for name, path := range m.paths {
+		d := m.dir(name)
+		if (unified != nil && path == unified.path) || (d.fd < 0 && !PathExists(path)) {
+			continue
+		}
+		if err := writeCgroupID(d, CgroupProcesses, cmd.Process.Pid); err != nil {
+			// Do not leave the child running outside of its cgroups.
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+			return err
+		}
+	}
+	return nil
+}
+
+func isCgroup2Dir(path string) bool {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return false
+	}
+	return st.Type == unix.CGROUP2_SUPER_MAGIC
+}
+
+// cloneIntoCgroupSupported reports whether the kernel is recent enough
+// (5.7) for clone3 with CLONE_INTO_CGROUP, and clone3 is not filtered out.
+func cloneIntoCgroupSupported() bool {
+	cloneIntoCgroupOnce.Do(func() {
+		var uts unix.Utsname
+		if err := unix.Uname(&uts); err != nil {
+			return
+		}
+		release := unix.ByteSliceToString(uts.Release[:])
+		var major, minor int
+		if _, err := fmt.Sscanf(release, "%d.%d", &major, &minor); err != nil {
+			return
+		}
+		if major < 5 || (major == 5 && minor < 7) {
+			return
+		}
+		// Seccomp profiles, such as the default one of Docker, may make
+		// clone3 fail with ENOSYS or EPERM, and an exec.Cmd can not be
+		// started again once it failed. Probe it up front: without
+		// arguments, clone3 fails with EINVAL if it is let through.
+		_, _, errno := unix.Syscall(unix.SYS_CLONE3, 0, 0, 0)
+		cloneIntoCgroup = errno != unix.ENOSYS && errno != unix.EPERM
+	})
+	return cloneIntoCgroup
+}
@@ -0,0 +1,159 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestWriteCgroupProcPidfd(t *testing.T) {
+	helper := NewCgroupTestUtil("cpu", t)
+	defer helper.cleanup()
+
+	pidfd, err := unix.PidfdOpen(os.Getpid(), 0)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer unix.Close(pidfd)
+
+	if err := WriteCgroupProcPidfd(helper.CgroupPath, pidfd); err != nil {
+		t.Fatal(err)
+	}
+	pids, err := GetPids(helper.CgroupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pids) != 1 || pids[0] != os.Getpid() {
+		t.Errorf("Expected pids [%d], got %v", os.Getpid(), pids)
+	}
+}
+
+func TestWriteCgroupProcPidfdExited(t *testing.T) {
+	helper := NewCgroupTestUtil("cpu", t)
+	defer helper.cleanup()
+
+	cmd := exec.Command("true")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	pidfd, err := unix.PidfdOpen(cmd.Process.Pid, 0)
+	if err != nil {
+		cmd.Wait()
+		t.Skip(err)
+	}
+	defer unix.Close(pidfd)
+	if err := cmd.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteCgroupProcPidfd(helper.CgroupPath, pidfd); err == nil {
+		t.Fatal("Expected moving an exited process to fail")
+	}
+	if _, err := os.Stat(filepath.Join(helper.CgroupPath, CgroupProcesses)); !os.IsNotExist(err) {
+		t.Error("Expected nothing to be written for an exited process")
+	}
+}
+
+func TestStartInCgroupUnified(t *testing.T) {
+	const unifiedMountpoint = "/sys/fs/cgroup/unified"
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	if !isCgroup2Dir(unifiedMountpoint) {
+		t.Skip("no cgroup v2 hierarchy at " + unifiedMountpoint)
+	}
+
+	name := fmt.Sprintf("test-clone-%d", time.Now().Nanosecond())
+	dir := filepath.Join(unifiedMountpoint, name)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(dir)
+
+	m := NewManager(&CgroupConfig{Resources: &Resources{}}, map[string]string{"unified": dir}, false)
+	defer m.Close()
+	cmd := exec.Command("sleep", "60")
+	if err := m.StartInCgroup(cmd); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	cgroups, err := ParseCgroupFile(fmt.Sprintf("/proc/%d/cgroup", cmd.Process.Pid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cgroups[""]; !strings.HasSuffix(got, "/"+name) {
+		t.Errorf("Expected child in cgroup %s, got %q", name, got)
+	}
+}
+
+func TestStartInCgroupUnifiedHandle(t *testing.T) {
+	const unifiedMountpoint = "/sys/fs/cgroup/unified"
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	if !isCgroup2Dir(unifiedMountpoint) || !cloneIntoCgroupSupported() {
+		t.Skip("no cgroup v2 hierarchy at " + unifiedMountpoint + " or no clone3")
+	}
+
+	name := fmt.Sprintf("test-clone-handle-%d", time.Now().Nanosecond())
+	dir := filepath.Join(unifiedMountpoint, name)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(&CgroupConfig{Resources: &Resources{}}, map[string]string{"unified": dir}, false)
+	defer m.Close()
+
+	// The child is created in the directory the manager opened: once that
+	// is removed, starting fails even with a new cgroup at the same path.
+	if err := os.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(dir)
+
+	cmd := exec.Command("sleep", "60")
+	if err := m.StartInCgroup(cmd); err == nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		t.Fatal("Expected StartInCgroup to fail for a removed cgroup")
+	}
+}
+
+func TestStartInCgroupKillsOnFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "start_in_cgroup_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Not a cgroup, so that moving the child fails after it started.
+	if err := os.Mkdir(filepath.Join(dir, CgroupProcesses), 0755); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(&CgroupConfig{Resources: &Resources{}}, map[string]string{"cpu": dir}, false)
+	defer m.Close()
+	cmd := exec.Command("sleep", "100")
+	if err := m.StartInCgroup(cmd); err == nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		t.Fatal("Expected StartInCgroup to fail")
+	}
+	if cmd.Process == nil || cmd.ProcessState == nil {
+		t.Fatal("Expected the child to be killed and waited for")
+	}
+}
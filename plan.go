@@ -0,0 +1,447 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type PlanAction string
+
+const (
+	PlanCreate PlanAction = "create"
+	PlanUpdate PlanAction = "update"
+	PlanRemove PlanAction = "remove"
+)
+
+// HierarchyNode is a cgroup in a declared hierarchy. Name is relative to
+// the parent node.
+type HierarchyNode struct {
+	Name      string           `json:"name"`
+	Resources *Resources       `json:"resources,omitempty"`
+	Children  []*HierarchyNode `json:"children,omitempty"`
+}
+
+// Hierarchy declares a whole cgroup tree below Root. With Prune set, cgroups
+// found below Root that are not declared are removed.
+type Hierarchy struct {
+	Root  string           `json:"root"`
+	Prune bool             `json:"prune,omitempty"`
+	Nodes []*HierarchyNode `json:"nodes"`
+}
+
+// FileChange is a single cgroup file whose value differs from the wanted one.
+type FileChange struct {
+	Subsystem string `json:"subsystem"`
+	File      string `json:"file"`
+	Old       string `json:"old"`
+	New       string `json:"new"`
+}
+
+// PlanStep is an action on one cgroup directory. Directories shared by
+// co-mounted subsystems (e.g. cpu,cpuacct) appear once.
+type PlanStep struct {
+	Action     PlanAction   `json:"action"`
+	Path       string       `json:"path"`
+	Subsystems []string     `json:"subsystems"`
+	Changes    []FileChange `json:"changes,omitempty"`
+
+	resources *Resources
+}
+
+// Plan is an ordered list of steps: creates and updates with parents before
+// children, followed by removals with children before parents.
+type Plan struct {
+	Steps []PlanStep `json:"steps"`
+
+	// root is the cgroupfs root given to ComputePlanWithRoot.
+	root string
+}
+
+// LoadHierarchy reads a JSON encoded Hierarchy from file.
+func LoadHierarchy(file string) (*Hierarchy, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	h := &Hierarchy{}
+	if err := json.Unmarshal(data, h); err != nil {
+		return nil, fmt.Errorf("invalid hierarchy in %s: %v", file, err)
+	}
+	return h, nil
+}
+
+// ComputePlan compares h with the live cgroup hierarchies and returns the
+// steps needed to make them match.
+func ComputePlan(h *Hierarchy) (*Plan, error) {
+	root, err := getCgroupRoot()
+	if err != nil {
+		return nil, err
+	}
+	return computePlanAt(root, h)
+}
+
+// ComputePlanWithRoot is like ComputePlan, but looks for the cgroup
+// hierarchies under root, as NewManagerWithRoot does. Apply of the plan
+// opens the files beneath root too.
+func ComputePlanWithRoot(root string, h *Hierarchy) (*Plan, error) {
+	if err := checkRoot(root); err != nil {
+		return nil, err
+	}
+	return computePlanAt(filepath.Clean(root), h)
+}
+
+func computePlanAt(root string, h *Hierarchy) (*Plan, error) {
+	mounts := make(map[string]string)
+	for _, sys := range subsystems {
+		mnt, err := FindCgroupMountpoint(root, sys.Name())
+		if err != nil {
+			if IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		mounts[sys.Name()] = mnt
+	}
+	r := cgroupfsRootAt(root)
+	defer r.close()
+	p, err := computePlan(r, h, mounts)
+	if err != nil {
+		return nil, err
+	}
+	p.root = root
+	return p, nil
+}
+
+type plannedNode struct {
+	path      string
+	resources *Resources
+}
+
+func computePlan(r *cgroupfsRoot, h *Hierarchy, mounts map[string]string) (*Plan, error) {
+	root := CleanPath(string(os.PathSeparator) + h.Root)
+	if h.Prune && root == string(os.PathSeparator) {
+		return nil, errors.New("cgroup: Prune needs a Root below the root cgroup")
+	}
+	nodes := []plannedNode{{path: root}}
+	if err := flattenNodes(root, h.Nodes, &nodes); err != nil {
+		return nil, err
+	}
+	wanted := make(map[string]bool)
+	for _, n := range nodes {
+		wanted[n.path] = true
+	}
+
+	plan := &Plan{}
+	steps := make(map[string]int)
+	for _, n := range nodes {
+		for _, sys := range subsystems {
+			mnt, ok := mounts[sys.Name()]
+			if !ok {
+				continue
+			}
+			dir := filepath.Join(mnt, n.path)
+			action := PlanUpdate
+			if !PathExists(dir) {
+				action = PlanCreate
+			}
+			changes, err := diffSettings(r.pathDir(dir), sys.Name(), n.resources, action == PlanCreate)
+			if err != nil {
+				return nil, err
+			}
+			if action == PlanUpdate && len(changes) == 0 {
+				continue
+			}
+			if i, ok := steps[dir]; ok {
+				plan.Steps[i].Subsystems = append(plan.Steps[i].Subsystems, sys.Name())
+				plan.Steps[i].Changes = append(plan.Steps[i].Changes, changes...)
+				continue
+			}
+			steps[dir] = len(plan.Steps)
+			plan.Steps = append(plan.Steps, PlanStep{
+				Action:     action,
+				Path:       dir,
+				Subsystems: []string{sys.Name()},
+				Changes:    changes,
+				resources:  n.resources,
+			})
+		}
+	}
+
+	if h.Prune {
+		removals, err := findUnwanted(root, wanted, mounts)
+		if err != nil {
+			return nil, err
+		}
+		plan.Steps = append(plan.Steps, removals...)
+	}
+	return plan, nil
+}
+
+func flattenNodes(parent string, children []*HierarchyNode, out *[]plannedNode) error {
+	for _, c := range children {
+		if c.Name == "" || strings.Contains(c.Name, string(os.PathSeparator)) || c.Name == "." || c.Name == ".." {
+			return fmt.Errorf("invalid cgroup name %q under %s", c.Name, parent)
+		}
+		path := filepath.Join(parent, c.Name)
+		*out = append(*out, plannedNode{path: path, resources: c.Resources})
+		if err := flattenNodes(path, c.Children, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findUnwanted returns remove steps for every cgroup below root that is not
+// wanted, deepest first.
+func findUnwanted(root string, wanted map[string]bool, mounts map[string]string) ([]PlanStep, error) {
+	var steps []PlanStep
+	seen := make(map[string]int)
+	for _, sys := range subsystems {
+		mnt, ok := mounts[sys.Name()]
+		if !ok {
+			continue
+		}
+		base := filepath.Join(mnt, root)
+		if !PathExists(base) {
+			continue
+		}
+		err := filepath.Walk(base, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() || p == base {
+				return nil
+			}
+			rel, err := filepath.Rel(mnt, p)
+			if err != nil {
+				return err
+			}
+			if wanted[filepath.Join(string(os.PathSeparator), rel)] {
+				return nil
+			}
+			if i, ok := seen[p]; ok {
+				steps[i].Subsystems = append(steps[i].Subsystems, sys.Name())
+			} else {
+				seen[p] = len(steps)
+				steps = append(steps, PlanStep{
+					Action:     PlanRemove,
+					Path:       p,
+					Subsystems: []string{sys.Name()},
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(steps, func(i, j int) bool {
+		return strings.Count(steps[i].Path, "/") > strings.Count(steps[j].Path, "/")
+	})
+	return steps, nil
+}
+
+// wantedSettings returns the files and values subsystem name would write for
+// r, in the order its Set method writes them.
+func wantedSettings(name string, r *Resources) []FileChange {
+	if r == nil {
+		return nil
+	}
+	var out []FileChange
+	add := func(file, value string) {
+		out = append(out, FileChange{Subsystem: name, File: file, New: value})
+	}
+	switch name {
+	case "cpu":
+		if r.CpuShares != 0 {
+			add("cpu.shares", strconv.FormatUint(r.CpuShares, 10))
+		}
+		if r.CpuPeriod != 0 {
+			add("cpu.cfs_period_us", strconv.FormatUint(r.CpuPeriod, 10))
+		}
+		if r.CpuQuota != 0 {
+			add("cpu.cfs_quota_us", strconv.FormatInt(r.CpuQuota, 10))
+		}
+		if r.CpuRtPeriod != 0 {
+			add("cpu.rt_period_us", strconv.FormatUint(r.CpuRtPeriod, 10))
+		}
+		if r.CpuRtRuntime != 0 {
+			add("cpu.rt_runtime_us", strconv.FormatInt(r.CpuRtRuntime, 10))
+		}
+	case "cpuset":
+		if r.CpusetCpus != "" {
+			add("cpuset.cpus", r.CpusetCpus)
+		}
+		if r.CpusetMems != "" {
+			add("cpuset.mems", r.CpusetMems)
+		}
+	case "freezer":
+		if r.Freezer == Frozen || r.Freezer == Thawed {
+			add("freezer.state", string(r.Freezer))
+		}
+	}
+	return out
+}
+
+func diffSettings(d *cgroupDir, name string, r *Resources, create bool) ([]FileChange, error) {
+	var changes []FileChange
+	for _, c := range wantedSettings(name, r) {
+		if !create {
+			old, err := d.paramString(c.File)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			if settingEqual(c.File, old, c.New) {
+				continue
+			}
+			c.Old = old
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// settingEqual compares a live value with a wanted one. cpuset lists are
+// compared as sets, since the kernel rewrites e.g. "0,1,2" as "0-2".
+func settingEqual(file, live, wanted string) bool {
+	if live == wanted {
+		return true
+	}
+	if file != "cpuset.cpus" && file != "cpuset.mems" {
+		return false
+	}
+	a, err := parseCpusetList(live)
+	if err != nil {
+		return false
+	}
+	b, err := parseCpusetList(wanted)
+	if err != nil {
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// maxCpusetID bounds the ids parseCpusetList accepts, well above the
+// largest CONFIG_NR_CPUS, so that a bogus range can not make it allocate
+// without limit.
+const maxCpusetID = 1 << 16
+
+// parseCpusetList parses a list such as "0-3,8" into a set of ids.
+func parseCpusetList(list string) (map[int]bool, error) {
+	ids := make(map[int]bool)
+	for _, part := range strings.Split(strings.TrimSpace(list), ",") {
+		if part == "" {
+			continue
+		}
+		bounds := strings.SplitN(part, "-", 2)
+		start, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if len(bounds) == 2 {
+			if end, err = strconv.Atoi(bounds[1]); err != nil {
+				return nil, err
+			}
+		}
+		if start < 0 || end < start || end > maxCpusetID {
+			return nil, fmt.Errorf("invalid cpuset range %q", part)
+		}
+		for i := start; i <= end; i++ {
+			ids[i] = true
+		}
+	}
+	return ids, nil
+}
+
+// Apply executes the plan steps in order, stopping at the first failure.
+func (p *Plan) Apply() error {
+	r := cgroupfsRootAt(p.root)
+	defer r.close()
+	for _, step := range p.Steps {
+		if err := step.apply(r); err != nil {
+			return fmt.Errorf("%s %s: %v", step.Action, step.Path, err)
+		}
+	}
+	return nil
+}
+
+func (s *PlanStep) apply(r *cgroupfsRoot) error {
+	if s.Action == PlanRemove {
+		return RemovePath(s.Path)
+	}
+	cg := &CgroupConfig{Resources: s.resources}
+	if cg.Resources == nil {
+		cg.Resources = &Resources{}
+	}
+	for _, name := range s.Subsystems {
+		sys, err := getSubsystem(name)
+		if err != nil {
+			return err
+		}
+		if s.Action == PlanCreate {
+			if cpuset, ok := sys.(*CpusetGroup); ok {
+				// Populates cpuset.cpus and cpuset.mems of the new
+				// cgroup and its parents before it can be used.
+				if err := cpuset.ApplyDir(s.Path, cg, -1); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := os.MkdirAll(s.Path, 0755); err != nil {
+				return err
+			}
+		}
+		if err := sys.set(r.pathDir(s.Path), cg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getSubsystem(name string) (subsystem, error) {
+	for _, sys := range subsystems {
+		if sys.Name() == name {
+			return sys, nil
+		}
+	}
+	if sys := lookupRegistered(name); sys != nil {
+		return sys, nil
+	}
+	return nil, errSubsystemDoesNotExist
+}
+
+// String renders the plan in a human readable form, one step per line
+// followed by its indented file changes.
+func (p *Plan) String() string {
+	if len(p.Steps) == 0 {
+		return "no changes\n"
+	}
+	var b strings.Builder
+	for _, step := range p.Steps {
+		fmt.Fprintf(&b, "%s %s (%s)\n", step.Action, step.Path, strings.Join(step.Subsystems, ","))
+		for _, c := range step.Changes {
+			if step.Action == PlanCreate {
+				fmt.Fprintf(&b, "    %s = %q\n", c.File, c.New)
+			} else {
+				fmt.Fprintf(&b, "    %s: %q -> %q\n", c.File, c.Old, c.New)
+			}
+		}
+	}
+	return b.String()
+}
+
+// JSON returns the plan encoded as indented JSON.
+func (p *Plan) JSON() ([]byte, error) {
+	return json.MarshalIndent(p, "", "  ")
+}
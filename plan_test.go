@@ -0,0 +1,137 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestComputeAndApplyPlan(t *testing.T) {
+	helper := NewCgroupTestUtil("cpu", t)
+	defer helper.cleanup()
+	mounts := map[string]string{"cpu": helper.CgroupPath}
+
+	for _, dir := range []string{"tenants/a", "tenants/old/child"} {
+		if err := os.MkdirAll(filepath.Join(helper.CgroupPath, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := WriteFile(filepath.Join(helper.CgroupPath, "tenants/a"), "cpu.shares", "1024"); err != nil {
+		t.Fatal(err)
+	}
+
+	h := &Hierarchy{
+		Root:  "tenants",
+		Prune: true,
+		Nodes: []*HierarchyNode{
+			{
+				Name:      "a",
+				Resources: &Resources{CpuShares: 512},
+				Children: []*HierarchyNode{
+					{Name: "web", Resources: &Resources{CpuShares: 256}},
+				},
+			},
+		},
+	}
+
+	plan, err := computePlan(defaultCgroupfsRoot, h, mounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type step struct {
+		action PlanAction
+		path   string
+	}
+	var got []step
+	for _, s := range plan.Steps {
+		rel, _ := filepath.Rel(helper.CgroupPath, s.Path)
+		got = append(got, step{s.Action, rel})
+	}
+	expected := []step{
+		{PlanUpdate, "tenants/a"},
+		{PlanCreate, "tenants/a/web"},
+		{PlanRemove, "tenants/old/child"},
+		{PlanRemove, "tenants/old"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected plan %v but found %v\n%s", expected, got, plan)
+	}
+
+	update := plan.Steps[0].Changes
+	if len(update) != 1 || update[0].Old != "1024" || update[0].New != "512" {
+		t.Errorf("Unexpected changes for update: %+v", update)
+	}
+	if !strings.Contains(plan.String(), `cpu.shares: "1024" -> "512"`) {
+		t.Errorf("Unexpected plan output:\n%s", plan)
+	}
+	data, err := plan.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Plan
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Steps) != len(plan.Steps) {
+		t.Errorf("Expected %d steps in JSON, found %d", len(plan.Steps), len(decoded.Steps))
+	}
+
+	if err := plan.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	value, err := GetCgroupParamUint(filepath.Join(helper.CgroupPath, "tenants/a/web"), "cpu.shares")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != 256 {
+		t.Errorf("Expected cpu.shares 256 after apply, found %d", value)
+	}
+	if PathExists(filepath.Join(helper.CgroupPath, "tenants/old")) {
+		t.Error("Expected tenants/old to be removed")
+	}
+
+	plan, err = computePlan(defaultCgroupfsRoot, h, mounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Steps) != 0 {
+		t.Errorf("Expected empty plan after apply, found:\n%s", plan)
+	}
+}
+
+func TestComputePlanPruneRoot(t *testing.T) {
+	helper := NewCgroupTestUtil("cpu", t)
+	defer helper.cleanup()
+	mounts := map[string]string{"cpu": helper.CgroupPath}
+
+	for _, root := range []string{"", "/", "a/.."} {
+		h := &Hierarchy{Root: root, Prune: true}
+		if _, err := computePlan(defaultCgroupfsRoot, h, mounts); err == nil {
+			t.Errorf("Expected pruning below root %q to be rejected", root)
+		}
+	}
+	if _, err := computePlan(defaultCgroupfsRoot, &Hierarchy{}, mounts); err != nil {
+		t.Errorf("Expected a plan for the root cgroup without Prune, got %v", err)
+	}
+}
+
+func TestParseCpusetList(t *testing.T) {
+	ids, err := parseCpusetList("0-2,8\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, map[int]bool{0: true, 1: true, 2: true, 8: true}) {
+		t.Errorf("Unexpected ids %v", ids)
+	}
+	for _, list := range []string{"3-1", "0-2147483647", "x"} {
+		if _, err := parseCpusetList(list); err == nil {
+			t.Errorf("Expected %q to be rejected", list)
+		}
+	}
+}
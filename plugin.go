@@ -0,0 +1,190 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Subsystem is a cgroup v1 controller, or named hierarchy, that is not built
+// into the package, such as misc or a site specific name=foo hierarchy.
+// Subsystems are added with Register, and only take part in the cgroups
+// whose CgroupConfig lists them in Subsystems.
+type Subsystem interface {
+	// Name returns the name of the hierarchy, as found in
+	// /proc/self/cgroup, e.g. "misc" or "name=foo".
+	Name() string
+	// Apply creates the cgroup at path and moves pid into it. pid is -1
+	// when the cgroup is only to be created.
+	Apply(path string, cgroup *CgroupConfig, pid int) error
+	// Set applies cgroup to the cgroup at path.
+	Set(path string, cgroup *CgroupConfig) error
+	// GetStats adds the statistics of the cgroup at path to stats, which
+	// GetStats reports in Stats.PluginStats under the subsystem's name.
+	GetStats(path string, stats map[string]uint64) error
+}
+
+var (
+	registryLock sync.Mutex
+	registered   []subsystem
+)
+
+// Register adds s to the subsystems managers know about. Its name may not
+// be the one of a built-in or already registered subsystem.
+func Register(s Subsystem) error {
+	name := s.Name()
+	if name == "" {
+		return fmt.Errorf("cgroup: subsystem has no name")
+	}
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	for _, sys := range allSubsystemsLocked() {
+		if sys.Name() == name {
+			return fmt.Errorf("cgroup: subsystem %s is already registered", name)
+		}
+	}
+	registered = append(registered, registeredSubsystem{s})
+	return nil
+}
+
+// allSubsystems returns the built-in and all the registered subsystems.
+func allSubsystems() []subsystem {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	return allSubsystemsLocked()
+}
+
+func allSubsystemsLocked() []subsystem {
+	all := make([]subsystem, 0, len(subsystems)+len(registered))
+	return append(append(all, subsystems...), registered...)
+}
+
+// lookupRegistered returns the registered subsystem called name, or nil.
+func lookupRegistered(name string) subsystem {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	for _, sys := range registered {
+		if sys.Name() == name {
+			return sys
+		}
+	}
+	return nil
+}
+
+// activeSubsystems returns the built-in subsystems, followed by the
+// registered ones c selects. If c lists its Controllers, only those are
+// returned.
+func activeSubsystems(c *CgroupConfig) []subsystem {
+	if c != nil && len(c.Controllers) > 0 {
+		var active []subsystem
+		for _, sys := range allSubsystems() {
+			for _, ctrl := range c.Controllers {
+				if ctrl.Name == sys.Name() {
+					active = append(active, sys)
+					break
+				}
+			}
+		}
+		return active
+	}
+	if c == nil || len(c.Subsystems) == 0 {
+		return subsystems
+	}
+	active := append([]subsystem(nil), subsystems...)
+	for _, name := range c.Subsystems {
+		if sys := lookupRegistered(name); sys != nil {
+			active = append(active, sys)
+		}
+	}
+	return active
+}
+
+// checkSubsystems returns an error if c selects a subsystem or controller
+// that is neither built-in nor registered, or uses both Subsystems and
+// Controllers.
+func checkSubsystems(c *CgroupConfig) error {
+	if len(c.Subsystems) > 0 && len(c.Controllers) > 0 {
+		return errors.New("cgroup: Subsystems and Controllers can not both be set, list the registered subsystems in Controllers")
+	}
+	for _, name := range c.Subsystems {
+		if lookupRegistered(name) == nil {
+			return fmt.Errorf("%v: %s is not registered", errSubsystemDoesNotExist, name)
+		}
+	}
+	for _, ctrl := range c.Controllers {
+		if ctrl.Name == UnifiedHierarchy {
+			continue
+		}
+		if _, err := getSubsystem(ctrl.Name); err != nil {
+			return fmt.Errorf("%v: %s", err, ctrl.Name)
+		}
+	}
+	return nil
+}
+
+// checkNoRegistered returns an error if c selects a registered subsystem.
+// op only knows the settings of the built-in subsystems, and could neither
+// diff nor roll back those of a registered one.
+func checkNoRegistered(c *CgroupConfig, op string) error {
+	for _, sys := range activeSubsystems(c) {
+		if _, ok := sys.(registeredSubsystem); ok {
+			return fmt.Errorf("cgroup: %s does not support the registered subsystem %s", op, sys.Name())
+		}
+	}
+	return nil
+}
+
+// registeredIn returns the names of the registered subsystems in paths.
+func registeredIn(paths map[string]string) []string {
+	var names []string
+	for _, sys := range allSubsystems() {
+		if _, ok := sys.(registeredSubsystem); !ok {
+			continue
+		}
+		if _, ok := paths[sys.Name()]; ok {
+			names = append(names, sys.Name())
+		}
+	}
+	return names
+}
+
+// registeredSubsystem adapts a Subsystem to the interface of the built-in
+// ones.
+type registeredSubsystem struct {
+	Subsystem
+}
+
+func (s registeredSubsystem) Apply(path string, d *cgroupData) error {
+	if path == "" {
+		return nil
+	}
+	return s.Subsystem.Apply(path, d.config, d.pid)
+}
+
+// Registered subsystems are given the path of the cgroup, and open its
+// files themselves.
+func (s registeredSubsystem) set(d *cgroupDir, cgroup *CgroupConfig) error {
+	return s.Subsystem.Set(d.path, cgroup)
+}
+
+func (s registeredSubsystem) getStats(d *cgroupDir, stats *Stats) error {
+	values := make(map[string]uint64)
+	if err := s.Subsystem.GetStats(d.path, values); err != nil {
+		return err
+	}
+	if stats.PluginStats == nil {
+		stats.PluginStats = make(map[string]map[string]uint64)
+	}
+	stats.PluginStats[s.Name()] = values
+	return nil
+}
+
+func (s registeredSubsystem) getResources(d *cgroupDir, r *Resources) error {
+	return nil
+}
+
+func (s registeredSubsystem) AddPid(path string, pid int) error {
+	return WriteCgroupProc(path, pid)
+}
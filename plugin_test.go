@@ -0,0 +1,147 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"strconv"
+	"testing"
+)
+
+type testPlugin struct{}
+
+func (testPlugin) Name() string { return "name=cgtest" }
+
+func (testPlugin) Apply(path string, cgroup *CgroupConfig, pid int) error {
+	return WriteCgroupProc(path, pid)
+}
+
+func (testPlugin) Set(path string, cgroup *CgroupConfig) error {
+	return WriteFile(path, "cgtest.shares", strconv.Itoa(42))
+}
+
+func (testPlugin) GetStats(path string, stats map[string]uint64) error {
+	value, err := GetCgroupParamUint(path, "cgtest.shares")
+	if err != nil {
+		return err
+	}
+	stats["shares"] = value
+	return nil
+}
+
+type namedPlugin struct {
+	testPlugin
+	name string
+}
+
+func (p namedPlugin) Name() string { return p.name }
+
+func TestRegisteredSubsystem(t *testing.T) {
+	if lookupRegistered(testPlugin{}.Name()) == nil {
+		if err := Register(testPlugin{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Register(testPlugin{}); err == nil {
+		t.Error("Expected registering a subsystem twice to fail")
+	}
+	if err := Register(namedPlugin{testPlugin{}, "cpu"}); err == nil {
+		t.Error("Expected registering a built-in subsystem to fail")
+	}
+
+	helper := NewCgroupTestUtil("cgtest", t)
+	defer helper.cleanup()
+
+	config := &CgroupConfig{
+		Subsystems: []string{testPlugin{}.Name()},
+		Resources:  &Resources{},
+	}
+	m := NewManager(config, map[string]string{testPlugin{}.Name(): helper.CgroupPath}, false)
+	defer m.Close()
+	if err := m.Set(&Config{Cgroups: config}); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := m.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stats.PluginStats[testPlugin{}.Name()]["shares"]; got != 42 {
+		t.Errorf("Expected plugin stats shares 42, got %d", got)
+	}
+
+	// Without selecting it, the subsystem does not take part.
+	m2 := NewManager(&CgroupConfig{Resources: &Resources{}}, map[string]string{testPlugin{}.Name(): helper.CgroupPath}, false)
+	defer m2.Close()
+	if stats, err = m2.GetStats(); err != nil {
+		t.Fatal(err)
+	}
+	if stats.PluginStats != nil {
+		t.Errorf("Expected no plugin stats, got %v", stats.PluginStats)
+	}
+}
+
+func TestSetDiffRegisteredSubsystem(t *testing.T) {
+	if lookupRegistered(testPlugin{}.Name()) == nil {
+		if err := Register(testPlugin{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	helper := NewCgroupTestUtil("cgtest", t)
+	defer helper.cleanup()
+
+	helper.writeFileContents(map[string]string{
+		"cgtest.shares": "1",
+	})
+
+	config := &CgroupConfig{
+		Subsystems: []string{testPlugin{}.Name()},
+		Resources:  &Resources{},
+	}
+	m := NewManager(config, map[string]string{testPlugin{}.Name(): helper.CgroupPath}, false)
+	defer m.Close()
+
+	// Neither can tell what the subsystem would write, so both refuse
+	// instead of silently leaving it alone.
+	if _, err := m.SetDiff(&Config{Cgroups: config}); err == nil {
+		t.Error("Expected SetDiff to fail with a registered subsystem")
+	}
+	if err := m.SetTransactional(&Config{Cgroups: config}); err == nil {
+		t.Error("Expected SetTransactional to fail with a registered subsystem")
+	}
+	value, err := GetCgroupParamString(helper.CgroupPath, "cgtest.shares")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "1" {
+		t.Errorf("Expected cgtest.shares to be left alone, got %s", value)
+	}
+}
+
+func TestApplyUnregisteredSubsystem(t *testing.T) {
+	if IsCgroup2UnifiedMode() {
+		t.Skip("cgroup v1 only")
+	}
+	config := &CgroupConfig{
+		Path:       "/test-unregistered",
+		Subsystems: []string{"name=does-not-exist"},
+		Resources:  &Resources{},
+	}
+	if err := NewManager(config, nil, false).Apply(-1); err == nil {
+		t.Fatal("Expected Apply to fail for an unregistered subsystem")
+	}
+}
+
+func TestApplySubsystemsAndControllers(t *testing.T) {
+	if IsCgroup2UnifiedMode() {
+		t.Skip("cgroup v1 only")
+	}
+	config := &CgroupConfig{
+		Path:        "/test-subsystems-controllers",
+		Subsystems:  []string{testPlugin{}.Name()},
+		Controllers: []Controller{{Name: "cpu"}},
+		Resources:   &Resources{},
+	}
+	if err := NewManager(config, nil, false).Apply(-1); err == nil {
+		t.Fatal("Expected Apply to fail with both Subsystems and Controllers")
+	}
+}
@@ -0,0 +1,182 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// errNotJoined is the reason given for the limits of a subsystem whose
+// cgroup the manager could not join or create.
+var errNotJoined = errors.New("container could not join or create cgroup")
+
+// UnappliedLimit is a limit a rootless manager could not apply.
+type UnappliedLimit struct {
+	Subsystem string
+	File      string
+	Value     string
+	Err       error
+}
+
+// UnappliedLimitsError is returned by Set on a rootless manager when some
+// limits could not be applied for lack of permissions. It lists every one of
+// them; all the others have been applied.
+type UnappliedLimitsError struct {
+	Limits []UnappliedLimit
+}
+
+func (e *UnappliedLimitsError) Error() string {
+	msgs := make([]string, 0, len(e.Limits))
+	for _, l := range e.Limits {
+		msgs = append(msgs, fmt.Sprintf("cannot set %s limit %s=%s: %v", l.Subsystem, l.File, l.Value, l.Err))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// setRootless is Set for rootless managers. Errors from the devices
+// subsystem are ignored, because it is really not expected to work, and
+// permission errors from the others do not stop it: every limit is tried,
+// and the ones that could not be applied are returned in an
+// *UnappliedLimitsError. Must be called with m.mu held.
+func (m *manager) setRootless(container *Config) error {
+	var unapplied []UnappliedLimit
+	for _, sys := range activeSubsystems(m.cgroups) {
+		path := m.paths[sys.Name()]
+		d := m.dir(sys.Name())
+		err := sys.set(d, container.Cgroups)
+		if err == nil || sys.Name() == "devices" {
+			continue
+		}
+		if path == "" {
+			reason := errNotJoined
+			if err, ok := m.skipped[sys.Name()]; ok {
+				reason = fmt.Errorf("%v: %w", errNotJoined, err)
+			}
+			for _, c := range wantedSettings(sys.Name(), container.Cgroups.Resources) {
+				unapplied = append(unapplied, UnappliedLimit{Subsystem: c.Subsystem, File: c.File, Value: c.New, Err: reason})
+			}
+			continue
+		}
+		if !isIgnorableError(true, err) {
+			return err
+		}
+		// Set stops at the first file it can not write. Retry the settings
+		// it did not apply one by one, still through Set so that they get
+		// the same checks, to find out exactly which ones are denied.
+		changes, derr := diffSettings(d, sys.Name(), container.Cgroups.Resources, false)
+		if derr != nil {
+			changes = wantedSettings(sys.Name(), container.Cgroups.Resources)
+		}
+		if len(changes) == 0 {
+			if len(wantedSettings(sys.Name(), container.Cgroups.Resources)) != 0 {
+				// Every setting already has its value, so the
+				// failure is not about one of them.
+				return err
+			}
+			unapplied = append(unapplied, UnappliedLimit{Subsystem: sys.Name(), Err: err})
+			continue
+		}
+		for _, c := range changes {
+			cg := *container.Cgroups
+			cg.Resources = &Resources{}
+			copySetting(cg.Resources, container.Cgroups.Resources, c.File)
+			if err := sys.set(d, &cg); err != nil {
+				if !isIgnorableError(true, err) {
+					return err
+				}
+				unapplied = append(unapplied, UnappliedLimit{Subsystem: c.Subsystem, File: c.File, Value: c.New, Err: err})
+			}
+		}
+	}
+	if len(unapplied) > 0 {
+		return &UnappliedLimitsError{Limits: unapplied}
+	}
+	return nil
+}
+
+// DelegationError is returned when a cgroup is not delegated to a user.
+type DelegationError struct {
+	Path string
+	Uid  int
+	// Files lists the files, and the directory itself as ".", that are
+	// not owned by Uid.
+	Files []string
+}
+
+func (e *DelegationError) Error() string {
+	return fmt.Sprintf("cgroup %s is not delegated to uid %d: %s not owned by it", e.Path, e.Uid, strings.Join(e.Files, ", "))
+}
+
+// delegateFiles returns the files of the cgroup at dir that the owner of a
+// delegated subtree must be able to write, besides the directory itself.
+func delegateFiles(dir string) []string {
+	if isCgroup2Dir(dir) {
+		return []string{CgroupProcesses, CgroupThreads, "cgroup.subtree_control"}
+	}
+	return []string{CgroupProcesses, CgroupTasks}
+}
+
+// Delegate hands the cgroup at dir over to uid and gid, so that they can
+// create sub-cgroups in it and move their processes between them. When
+// running as root, the directory and its cgroup.procs, cgroup.threads and
+// cgroup.subtree_control files (cgroup.procs and tasks on cgroup v1) are
+// chowned; otherwise the delegation is only verified.
+//
+// Moving processes into the subtree also requires write access to the
+// cgroup.procs file of the common ancestor of the source and destination
+// cgroups, which is left to the caller.
+func Delegate(dir string, uid, gid int) error {
+	if os.Geteuid() == 0 {
+		if err := os.Chown(dir, uid, gid); err != nil {
+			return err
+		}
+		for _, file := range delegateFiles(dir) {
+			err := os.Chown(filepath.Join(dir, file), uid, gid)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return CheckDelegation(dir, uid)
+}
+
+// CheckDelegation verifies that the cgroup at dir is delegated to uid, as
+// Delegate does it.
+func CheckDelegation(dir string, uid int) error {
+	var notOwned []string
+	for _, file := range append([]string{"."}, delegateFiles(dir)...) {
+		fi, err := os.Stat(filepath.Join(dir, file))
+		if err != nil {
+			if os.IsNotExist(err) && file != "." {
+				continue
+			}
+			return err
+		}
+		if st, ok := fi.Sys().(*syscall.Stat_t); !ok || int(st.Uid) != uid {
+			notOwned = append(notOwned, file)
+		}
+	}
+	if len(notOwned) > 0 {
+		return &DelegationError{Path: dir, Uid: uid, Files: notOwned}
+	}
+	return nil
+}
+
+// Delegate delegates all of the manager's cgroups to uid and gid, see
+// Delegate.
+func (m *manager) Delegate(uid, gid int) error {
+	for _, path := range m.GetPaths() {
+		if !PathExists(path) {
+			continue
+		}
+		if err := Delegate(path, uid, gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestSetRootlessReportsUnappliedLimits(t *testing.T) {
+	helper := NewCgroupTestUtil("cpu", t)
+	defer helper.cleanup()
+
+	config := &CgroupConfig{
+		Resources: &Resources{
+			CpuShares:  512,
+			CpusetCpus: "0",
+		},
+	}
+	// Pretend Apply could only create the cpu cgroup.
+	m := NewManager(config, map[string]string{"cpu": helper.CgroupPath}, true).(*manager)
+	defer m.Close()
+	m.skipped = map[string]error{"cpuset": os.ErrPermission}
+
+	err := m.Set(&Config{Cgroups: config})
+	var unapplied *UnappliedLimitsError
+	if !errors.As(err, &unapplied) {
+		t.Fatalf("Expected *UnappliedLimitsError, got %v", err)
+	}
+	if len(unapplied.Limits) != 1 {
+		t.Fatalf("Expected a single unapplied limit, got %v", unapplied.Limits)
+	}
+	l := unapplied.Limits[0]
+	if l.Subsystem != "cpuset" || l.File != "cpuset.cpus" || l.Value != "0" || !errors.Is(l.Err, os.ErrPermission) {
+		t.Errorf("Unexpected unapplied limit %+v", l)
+	}
+
+	shares, err := GetCgroupParamUint(helper.CgroupPath, "cpu.shares")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shares != 512 {
+		t.Errorf("Expected cpu.shares to be applied, got %d", shares)
+	}
+}
+
+func TestSetRootlessKeepsErrorWithoutChanges(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	helper := NewCgroupTestUtil("cpu", t)
+	defer helper.cleanup()
+	helper.writeFileContents(map[string]string{
+		"cpu.shares": "512",
+	})
+
+	// Make the write fail with EROFS even though the value is unchanged.
+	if err := unix.Mount(helper.CgroupPath, helper.CgroupPath, "", unix.MS_BIND, ""); err != nil {
+		t.Skip(err)
+	}
+	defer unix.Unmount(helper.CgroupPath, unix.MNT_DETACH)
+	if err := unix.Mount("", helper.CgroupPath, "", unix.MS_BIND|unix.MS_REMOUNT|unix.MS_RDONLY, ""); err != nil {
+		t.Skip(err)
+	}
+
+	config := &CgroupConfig{
+		Resources: &Resources{
+			CpuShares: 512,
+		},
+	}
+	m := NewManager(config, map[string]string{"cpu": helper.CgroupPath}, true)
+	defer m.Close()
+
+	err := m.Set(&Config{Cgroups: config})
+	if !errors.Is(err, unix.EROFS) {
+		t.Fatalf("Expected the EROFS error of Set, got %v", err)
+	}
+	var unapplied *UnappliedLimitsError
+	if errors.As(err, &unapplied) {
+		t.Errorf("Expected no unapplied limits, got %v", unapplied.Limits)
+	}
+}
+
+func TestApplyResetsSkipped(t *testing.T) {
+	m := NewManager(&CgroupConfig{Paths: map[string]string{}, Resources: &Resources{}}, nil, true).(*manager)
+	defer m.Close()
+	m.skipped = map[string]error{"cpuset": os.ErrPermission}
+	if err := m.Apply(-1); err != nil {
+		t.Fatal(err)
+	}
+	if m.skipped != nil {
+		t.Errorf("Expected Apply to forget the subsystems skipped before, got %v", m.skipped)
+	}
+}
+
+func TestDelegate(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	helper := NewCgroupTestUtil("cpu", t)
+	defer helper.cleanup()
+	helper.writeFileContents(map[string]string{
+		CgroupProcesses: "",
+		CgroupTasks:     "",
+	})
+
+	if err := CheckDelegation(helper.CgroupPath, 1000); err == nil {
+		t.Fatal("Expected cgroup not to be delegated yet")
+	}
+	if err := Delegate(helper.CgroupPath, 1000, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckDelegation(helper.CgroupPath, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chown(filepath.Join(helper.CgroupPath, CgroupTasks), 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	err := CheckDelegation(helper.CgroupPath, 1000)
+	var derr *DelegationError
+	if !errors.As(err, &derr) {
+		t.Fatalf("Expected *DelegationError, got %v", err)
+	}
+	if len(derr.Files) != 1 || derr.Files[0] != CgroupTasks {
+		t.Errorf("Expected only %s to be reported, got %v", CgroupTasks, derr.Files)
+	}
+}
@@ -42,6 +42,9 @@ type MemoryStats struct {
 type Stats struct {
 	CpuStats    CpuStats    `json:"cpu_stats,omitempty"`
 	MemoryStats MemoryStats `json:"memory_stats,omitempty"`
+	// PluginStats holds the statistics of the registered subsystems, by
+	// subsystem name.
+	PluginStats map[string]map[string]uint64 `json:"plugin_stats,omitempty"`
 }
 
 func NewStats() *Stats {
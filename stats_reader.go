@@ -0,0 +1,297 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+)
+
+const cgroupCpuacctUsagePercpu = "cpuacct.usage_percpu"
+
+// StatsReader samples the cpu and cpuacct statistics of a cgroup. Unlike
+// GetStats, it keeps the stat files open between samples and rereads them
+// from offset 0, and reuses its buffers and the slices in the Stats it is
+// given, so that frequent sampling of many cgroups stays cheap.
+//
+// A StatsReader is safe for concurrent use, but samples are serialized.
+type StatsReader struct {
+	mu          sync.Mutex
+	cpuPath     string
+	cpuacctPath string
+	cpuDir      *cgroupDir
+	cpuacctDir  *cgroupDir
+	files       map[string]*os.File
+	missing     map[string]bool
+	buf         []byte
+}
+
+// NewStatsReader returns a StatsReader for the given cpu and cpuacct cgroup
+// directories. Either may be empty.
+func NewStatsReader(cpuPath, cpuacctPath string) *StatsReader {
+	return &StatsReader{
+		cpuPath:     cpuPath,
+		cpuacctPath: cpuacctPath,
+		cpuDir:      pathDir(cpuPath),
+		cpuacctDir:  pathDir(cpuacctPath),
+		files:       make(map[string]*os.File),
+		missing:     make(map[string]bool),
+		buf:         make([]byte, 4096),
+	}
+}
+
+// NewStatsReader returns a StatsReader for the manager's cgroups. It opens
+// the stat files relative to its own copies of the manager's directory
+// handles.
+func (m *manager) NewStatsReader() *StatsReader {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := NewStatsReader(m.paths["cpu"], m.paths["cpuacct"])
+	r.cpuDir = m.dir("cpu").dup()
+	r.cpuacctDir = m.dir("cpuacct").dup()
+	return r
+}
+
+// Close closes all cached file descriptors, and the directory handles of a
+// reader returned by Manager.NewStatsReader, after which its files are
+// opened by path.
+func (r *StatsReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cpuDir.close()
+	r.cpuacctDir.close()
+	var err error
+	for name, f := range r.files {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		delete(r.files, name)
+	}
+	return err
+}
+
+// GetStatsInto fills the cpu statistics of stats, the same ones GetStats
+// reports for the cpu and cpuacct subsystems.
+func (r *StatsReader) GetStatsInto(stats *Stats) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cpuPath != "" {
+		if err := r.readCpuStat(stats); err != nil {
+			return err
+		}
+	}
+	if r.cpuacctPath != "" {
+		if err := r.readCpuacct(stats); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// read returns the current contents of file in d. The returned slice is
+// only valid until the next call. A nil slice means the file does not exist.
+func (r *StatsReader) read(d *cgroupDir, file string) ([]byte, error) {
+	key := d.path + "/" + file
+	if r.missing[key] {
+		return nil, nil
+	}
+	f, ok := r.files[key]
+	if !ok {
+		var err error
+		f, err = d.openFile(file, os.O_RDONLY)
+		if err != nil {
+			if os.IsNotExist(err) {
+				r.missing[key] = true
+				return nil, nil
+			}
+			return nil, err
+		}
+		r.files[key] = f
+	}
+
+	for {
+		n, err := f.ReadAt(r.buf, 0)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if n < len(r.buf) {
+			return r.buf[:n], nil
+		}
+		// The file did not fit, grow the buffer and read it again.
+		r.buf = make([]byte, 2*len(r.buf))
+	}
+}
+
+func (r *StatsReader) readCpuStat(stats *Stats) error {
+	data, err := r.read(r.cpuDir, "cpu.stat")
+	if err != nil || data == nil {
+		return err
+	}
+	throttling := &stats.CpuStats.ThrottlingData
+	for len(data) > 0 {
+		var line []byte
+		line, data = nextLine(data)
+		key, value, err := parseKeyValue(line)
+		if err != nil {
+			return fmt.Errorf("invalid line %q in %s/cpu.stat: %v", line, r.cpuPath, err)
+		}
+		switch string(key) {
+		case "nr_periods":
+			throttling.Periods = value
+		case "nr_throttled":
+			throttling.ThrottledPeriods = value
+		case "throttled_time":
+			throttling.ThrottledTime = value
+		}
+	}
+	return nil
+}
+
+func (r *StatsReader) readCpuacct(stats *Stats) error {
+	usage := &stats.CpuStats.CpuUsage
+
+	data, err := r.read(r.cpuacctDir, "cpuacct.usage")
+	if err != nil {
+		return err
+	}
+	if data != nil {
+		if usage.TotalUsage, err = parseUintBytes(bytes.TrimSpace(data)); err != nil {
+			return fmt.Errorf("unable to parse %s/cpuacct.usage: %v", r.cpuacctPath, err)
+		}
+	}
+
+	data, err = r.read(r.cpuacctDir, cgroupCpuacctStat)
+	if err != nil {
+		return err
+	}
+	for len(data) > 0 {
+		var line []byte
+		line, data = nextLine(data)
+		key, value, err := parseKeyValue(line)
+		if err != nil {
+			return fmt.Errorf("invalid line %q in %s/%s: %v", line, r.cpuacctPath, cgroupCpuacctStat, err)
+		}
+		switch string(key) {
+		case "user":
+			usage.UsageInUsermode = (value * nanosecondsInSecond) / clockTicks
+		case "system":
+			usage.UsageInKernelmode = (value * nanosecondsInSecond) / clockTicks
+		}
+	}
+
+	data, err = r.read(r.cpuacctDir, cgroupCpuacctUsagePercpu)
+	if err != nil {
+		return err
+	}
+	usage.PercpuUsage = usage.PercpuUsage[:0]
+	for {
+		var field []byte
+		if field, data = nextField(data); field == nil {
+			break
+		}
+		value, err := parseUintBytes(field)
+		if err != nil {
+			return fmt.Errorf("unable to parse %s/%s: %v", r.cpuacctPath, cgroupCpuacctUsagePercpu, err)
+		}
+		usage.PercpuUsage = append(usage.PercpuUsage, value)
+	}
+
+	data, err = r.read(r.cpuacctDir, cgroupCpuacctUsageAll)
+	if err != nil {
+		return err
+	}
+	usage.PercpuUsageInKernelmode = usage.PercpuUsageInKernelmode[:0]
+	usage.PercpuUsageInUsermode = usage.PercpuUsageInUsermode[:0]
+	// Skip the header line.
+	_, data = nextLine(data)
+	for len(data) > 0 {
+		var line []byte
+		line, data = nextLine(data)
+		var columns [cuacctUsageAllColumnsNumber][]byte
+		n := 0
+		for ; n <= len(columns); n++ {
+			var field []byte
+			if field, line = nextField(line); field == nil {
+				break
+			}
+			if n < len(columns) {
+				columns[n] = field
+			}
+		}
+		if n != cuacctUsageAllColumnsNumber {
+			continue
+		}
+		kernel, err := parseUintBytes(columns[kernelModeColumn])
+		if err != nil {
+			return fmt.Errorf("Unable to convert CPU usage in kernel mode to uint64: %s", err)
+		}
+		user, err := parseUintBytes(columns[userModeColumn])
+		if err != nil {
+			return fmt.Errorf("Unable to convert CPU usage in user mode to uint64: %s", err)
+		}
+		usage.PercpuUsageInKernelmode = append(usage.PercpuUsageInKernelmode, kernel)
+		usage.PercpuUsageInUsermode = append(usage.PercpuUsageInUsermode, user)
+	}
+	return nil
+}
+
+func nextLine(data []byte) ([]byte, []byte) {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return data[:i], data[i+1:]
+	}
+	return data, nil
+}
+
+// nextField returns the first whitespace separated field of data and the
+// rest after it, or a nil field if there is none.
+func nextField(data []byte) ([]byte, []byte) {
+	start := 0
+	for start < len(data) && isSpace(data[start]) {
+		start++
+	}
+	if start == len(data) {
+		return nil, nil
+	}
+	end := start
+	for end < len(data) && !isSpace(data[end]) {
+		end++
+	}
+	return data[start:end], data[end:]
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+// parseKeyValue is an allocation free GetCgroupParamKeyValue.
+func parseKeyValue(line []byte) ([]byte, uint64, error) {
+	line = bytes.TrimSpace(line)
+	i := bytes.IndexByte(line, ' ')
+	if i < 0 {
+		return nil, 0, ErrNotValidFormat
+	}
+	value, err := parseUintBytes(bytes.TrimSpace(line[i+1:]))
+	return line[:i], value, err
+}
+
+// parseUintBytes is an allocation free ParseUint for plain decimal numbers.
+// Anything else, such as negative or overflowing values, is left to
+// ParseUint, so that both always agree.
+func parseUintBytes(b []byte) (uint64, error) {
+	if len(b) == 0 {
+		return 0, ErrNotValidFormat
+	}
+	var v uint64
+	for _, c := range b {
+		if c < '0' || c > '9' || v > (math.MaxUint64-uint64(c-'0'))/10 {
+			return ParseUint(string(b), 10, 64)
+		}
+		v = v*10 + uint64(c-'0')
+	}
+	return v, nil
+}
@@ -0,0 +1,195 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// RollbackError is returned by SetTransactional when applying the new
+// settings failed. Err is the original failure, RollbackErrs lists the files
+// that could not be restored afterwards.
+type RollbackError struct {
+	Err          error
+	RollbackErrs []error
+}
+
+func (e *RollbackError) Error() string {
+	if len(e.RollbackErrs) == 0 {
+		return fmt.Sprintf("%v (rolled back)", e.Err)
+	}
+	msgs := make([]string, 0, len(e.RollbackErrs))
+	for _, err := range e.RollbackErrs {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%v (rollback failed: %s)", e.Err, strings.Join(msgs, "; "))
+}
+
+func (e *RollbackError) Unwrap() error {
+	return e.Err
+}
+
+type savedFile struct {
+	dir   *cgroupDir
+	file  string
+	value string
+}
+
+// snapshotSettings saves the current value of every file sys would write
+// for r in d. A freezer caught FREEZING is saved as FROZEN, the state it
+// was going to, as FREEZING can not be written back.
+func snapshotSettings(d *cgroupDir, name string, r *Resources) ([]savedFile, error) {
+	var saved []savedFile
+	for _, c := range wantedSettings(name, r) {
+		value, err := d.paramString(c.File)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		if c.File == "freezer.state" && value == string(Freezing) {
+			value = string(Frozen)
+		}
+		saved = append(saved, savedFile{dir: d, file: c.File, value: value})
+	}
+	return saved, nil
+}
+
+// SetTransactional is like Set, but restores the previous values of the
+// files it wrote, in reverse order, if any subsystem fails to apply. It
+// fails for cgroups that use registered subsystems.
+func (m *manager) SetTransactional(container *Config) error {
+	if container.Cgroups == nil {
+		return nil
+	}
+
+	// If Paths are set, then we are just joining cgroups paths
+	// and there is no need to set any values.
+	if m.cgroups != nil && m.cgroups.Paths != nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := checkNoRegistered(m.cgroups, "SetTransactional"); err != nil {
+		return err
+	}
+	container = m.withParams(container)
+
+	var saved []savedFile
+	for _, sys := range activeSubsystems(m.cgroups) {
+		path := m.paths[sys.Name()]
+		if path == "" {
+			continue
+		}
+		s, err := snapshotSettings(m.dir(sys.Name()), sys.Name(), container.Cgroups.Resources)
+		if err != nil {
+			return err
+		}
+		saved = append(saved, s...)
+	}
+
+	written := make(map[string]bool)
+	for _, sys := range activeSubsystems(m.cgroups) {
+		path := m.paths[sys.Name()]
+		err := sys.set(m.dir(sys.Name()).recordWrites(written), container.Cgroups)
+		if err == nil || (m.rootless && sys.Name() == "devices") {
+			continue
+		}
+		if path == "" {
+			err = fmt.Errorf("cannot set %s limit: container could not join or create cgroup", sys.Name())
+		}
+		return &RollbackError{Err: err, RollbackErrs: rollback(saved, written)}
+	}
+	return nil
+}
+
+// rollback restores the saved files that are in written.
+func rollback(saved []savedFile, written map[string]bool) []error {
+	var errs []error
+	for i := len(saved) - 1; i >= 0; i-- {
+		s := saved[i]
+		if !written[s.dir.path+"/"+s.file] {
+			continue
+		}
+		if err := s.dir.writeFile(s.file, s.value); err != nil {
+			errs = append(errs, fmt.Errorf("restoring %s/%s: %v", s.dir.path, s.file, err))
+		}
+	}
+	return errs
+}
+
+// SetDiff is like Set, but reads the current value of every setting first
+// and only writes the ones that differ. It returns the files it changed. It
+// fails for cgroups that use registered subsystems.
+func (m *manager) SetDiff(container *Config) ([]FileChange, error) {
+	if container.Cgroups == nil {
+		return nil, nil
+	}
+
+	// If Paths are set, then we are just joining cgroups paths
+	// and there is no need to set any values.
+	if m.cgroups != nil && m.cgroups.Paths != nil {
+		return nil, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := checkNoRegistered(m.cgroups, "SetDiff"); err != nil {
+		return nil, err
+	}
+	container = m.withParams(container)
+
+	var changed []FileChange
+	for _, sys := range activeSubsystems(m.cgroups) {
+		path := m.paths[sys.Name()]
+		d := m.dir(sys.Name())
+		changes, err := diffSettings(d, sys.Name(), container.Cgroups.Resources, path == "")
+		if err != nil {
+			return changed, err
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		if path == "" {
+			return changed, fmt.Errorf("cannot set %s limit: container could not join or create cgroup", sys.Name())
+		}
+
+		// Only pass the changed settings on, so that Set keeps its
+		// validation but leaves everything else alone.
+		r := &Resources{}
+		for _, c := range changes {
+			copySetting(r, container.Cgroups.Resources, c.File)
+		}
+		if err := sys.set(d, &CgroupConfig{Resources: r}); err != nil {
+			return changed, err
+		}
+		changed = append(changed, changes...)
+	}
+	return changed, nil
+}
+
+// copySetting copies the Resources field backing file from src to dst.
+func copySetting(dst, src *Resources, file string) {
+	switch file {
+	case "cpu.shares":
+		dst.CpuShares = src.CpuShares
+	case "cpu.cfs_period_us":
+		dst.CpuPeriod = src.CpuPeriod
+	case "cpu.cfs_quota_us":
+		dst.CpuQuota = src.CpuQuota
+	case "cpu.rt_period_us":
+		dst.CpuRtPeriod = src.CpuRtPeriod
+	case "cpu.rt_runtime_us":
+		dst.CpuRtRuntime = src.CpuRtRuntime
+	case "cpuset.cpus":
+		dst.CpusetCpus = src.CpusetCpus
+	case "cpuset.mems":
+		dst.CpusetMems = src.CpusetMems
+	case "freezer.state":
+		dst.Freezer = src.Freezer
+	}
+}
@@ -0,0 +1,159 @@
+// +build linux
+
+package cgroupManager
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSetTransactionalRollback(t *testing.T) {
+	helper := NewCgroupTestUtil("cpu", t)
+	defer helper.cleanup()
+
+	helper.writeFileContents(map[string]string{
+		"cpu.shares":       "1024",
+		"cpu.cfs_quota_us": "-1",
+	})
+
+	paths := map[string]string{
+		"cpu": helper.CgroupPath,
+		// Missing directory, so that setting the freezer state fails
+		// after the cpu subsystem has been written.
+		"freezer": filepath.Join(helper.tempDir, "freezer"),
+	}
+	m := NewManager(&CgroupConfig{Resources: &Resources{}}, paths, false)
+	defer m.Close()
+
+	config := &Config{Cgroups: &CgroupConfig{Resources: &Resources{
+		CpuShares: 512,
+		CpuQuota:  50000,
+		Freezer:   Frozen,
+	}}}
+	err := m.SetTransactional(config)
+	if err == nil {
+		t.Fatal("Expected SetTransactional to fail")
+	}
+	var rbErr *RollbackError
+	if !errors.As(err, &rbErr) {
+		t.Fatalf("Expected a RollbackError, got %T: %v", err, err)
+	}
+	if len(rbErr.RollbackErrs) != 0 {
+		t.Errorf("Unexpected rollback errors: %v", rbErr.RollbackErrs)
+	}
+
+	shares, err := GetCgroupParamUint(helper.CgroupPath, "cpu.shares")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shares != 1024 {
+		t.Errorf("Expected cpu.shares to be rolled back to 1024, got %d", shares)
+	}
+	quota, err := GetCgroupParamInt(helper.CgroupPath, "cpu.cfs_quota_us")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quota != -1 {
+		t.Errorf("Expected cpu.cfs_quota_us to be rolled back to -1, got %d", quota)
+	}
+}
+
+func TestRollbackOnlyRestoresWrittenFiles(t *testing.T) {
+	helper := NewCgroupTestUtil("cpu", t)
+	defer helper.cleanup()
+
+	helper.writeFileContents(map[string]string{
+		"cpu.shares":       "512",
+		"cpu.cfs_quota_us": "5000",
+	})
+
+	d := pathDir(helper.CgroupPath)
+	saved := []savedFile{
+		{dir: d, file: "cpu.shares", value: "1024"},
+		{dir: d, file: "cpu.cfs_quota_us", value: "-1"},
+	}
+	written := map[string]bool{helper.CgroupPath + "/cpu.shares": true}
+	if errs := rollback(saved, written); len(errs) != 0 {
+		t.Fatalf("Unexpected rollback errors: %v", errs)
+	}
+
+	shares, err := GetCgroupParamUint(helper.CgroupPath, "cpu.shares")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shares != 1024 {
+		t.Errorf("Expected cpu.shares to be rolled back to 1024, got %d", shares)
+	}
+	quota, err := GetCgroupParamInt(helper.CgroupPath, "cpu.cfs_quota_us")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quota != 5000 {
+		t.Errorf("Expected cpu.cfs_quota_us, which was not written, to be left at 5000, got %d", quota)
+	}
+}
+
+func TestSnapshotFreezing(t *testing.T) {
+	helper := NewCgroupTestUtil("freezer", t)
+	defer helper.cleanup()
+
+	helper.writeFileContents(map[string]string{
+		"freezer.state": string(Freezing),
+	})
+
+	saved, err := snapshotSettings(pathDir(helper.CgroupPath), "freezer", &Resources{Freezer: Thawed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 1 || saved[0].value != string(Frozen) {
+		t.Errorf("Expected FREEZING to be saved as FROZEN, got %+v", saved)
+	}
+}
+
+func TestSetDiffOnlyWritesChanges(t *testing.T) {
+	cpu := NewCgroupTestUtil("cpu", t)
+	defer cpu.cleanup()
+	cpuset := NewCgroupTestUtil("cpuset", t)
+	defer cpuset.cleanup()
+
+	cpu.writeFileContents(map[string]string{
+		"cpu.shares":       "512",
+		"cpu.cfs_quota_us": "-1",
+	})
+	cpuset.writeFileContents(map[string]string{
+		"cpuset.cpus": "0-1",
+	})
+
+	paths := map[string]string{
+		"cpu":    cpu.CgroupPath,
+		"cpuset": cpuset.CgroupPath,
+	}
+	m := NewManager(&CgroupConfig{Resources: &Resources{}}, paths, false)
+	defer m.Close()
+
+	config := &Config{Cgroups: &CgroupConfig{Resources: &Resources{
+		CpuShares:  512,
+		CpuQuota:   5000,
+		CpusetCpus: "0,1",
+	}}}
+	changes, err := m.SetDiff(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []FileChange{
+		{Subsystem: "cpu", File: "cpu.cfs_quota_us", Old: "-1", New: "5000"},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected changes %+v but found %+v", expected, changes)
+	}
+
+	changes, err = m.SetDiff(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("Expected no changes on second SetDiff, found %+v", changes)
+	}
+}
@@ -21,12 +21,21 @@ import (
 
 const (
 	CgroupProcesses   = "cgroup.procs"
+	CgroupTasks       = "tasks"
+	CgroupThreads     = "cgroup.threads"
 	unifiedMountpoint = "/sys/fs/cgroup"
+	hybridMountpoint  = "/sys/fs/cgroup/unified"
+
+	// UnifiedHierarchy is the key of the cgroup v2 path in a manager's
+	// paths when running in hybrid mode.
+	UnifiedHierarchy = "unified"
 )
 
 var (
 	isUnifiedOnce sync.Once
 	isUnified     bool
+	isHybridOnce  sync.Once
+	isHybrid      bool
 )
 
 func CleanPath(path string) string {
@@ -59,6 +68,50 @@ func IsCgroup2UnifiedMode() bool {
 	return isUnified
 }
 
+// IsCgroup2HybridMode returns whether the host uses systemd's hybrid layout:
+// cgroup v1 controllers, plus a cgroup v2 hierarchy without controllers
+// mounted at /sys/fs/cgroup/unified.
+func IsCgroup2HybridMode() bool {
+	isHybridOnce.Do(func() {
+		if IsCgroup2UnifiedMode() {
+			return
+		}
+		var st unix.Statfs_t
+		if err := unix.Statfs(hybridMountpoint, &st); err != nil {
+			return
+		}
+		isHybrid = st.Type == unix.CGROUP2_SUPER_MAGIC
+	})
+	return isHybrid
+}
+
+// isCgroup2UnifiedModeAt is IsCgroup2UnifiedMode for the cgroupfs mounted at
+// root, the default one if root is empty.
+func isCgroup2UnifiedModeAt(root string) bool {
+	if root == "" || root == unifiedMountpoint {
+		return IsCgroup2UnifiedMode()
+	}
+	return isCgroup2Dir(root)
+}
+
+// isCgroup2HybridModeAt is IsCgroup2HybridMode for the cgroupfs mounted at
+// root, the default one if root is empty.
+func isCgroup2HybridModeAt(root string) bool {
+	if root == "" || root == unifiedMountpoint {
+		return IsCgroup2HybridMode()
+	}
+	return !isCgroup2Dir(root) && isCgroup2Dir(hybridMountpointAt(root))
+}
+
+// hybridMountpointAt is where the cgroup v2 hierarchy of a hybrid mode
+// cgroupfs mounted at root is, the default one if root is empty.
+func hybridMountpointAt(root string) string {
+	if root == "" {
+		return hybridMountpoint
+	}
+	return filepath.Join(root, UnifiedHierarchy)
+}
+
 type Mount struct {
 	Mountpoint string
 	Root       string
@@ -278,22 +331,64 @@ func GetAllPids(path string) ([]int, error) {
 }
 
 func WriteCgroupProc(dir string, pid int) error {
-	if dir == "" {
-		return fmt.Errorf("no such directory for %s", CgroupProcesses)
+	return writeCgroupID(pathDir(dir), CgroupProcesses, pid)
+}
+
+// threadsFile returns the file listing the threads of the cgroup d:
+// cgroup.threads on cgroup v2 and tasks on v1.
+func threadsFile(d *cgroupDir) string {
+	if d.isCgroup2() {
+		return CgroupThreads
+	}
+	return CgroupTasks
+}
+
+// WriteCgroupThread moves the single thread tid into the cgroup at dir. On
+// cgroup v2, dir must be part of a threaded subtree (see EnableThreaded).
+func WriteCgroupThread(dir string, tid int) error {
+	return writeCgroupID(pathDir(dir), threadsFile(pathDir(dir)), tid)
+}
+
+// GetThreads returns the ids of the threads in the cgroup at dir.
+func GetThreads(dir string) ([]int, error) {
+	return readProcsFile(filepath.Join(dir, threadsFile(pathDir(dir))))
+}
+
+// isThreadedCgroup reports whether the cgroup v2 directory dir is threaded,
+// or the root of a threaded subtree.
+func isThreadedCgroup(dir string) bool {
+	typ, err := ReadFile(dir, "cgroup.type")
+	if err != nil {
+		return false
+	}
+	typ = strings.TrimSpace(typ)
+	return typ == "threaded" || typ == "domain threaded"
+}
+
+// EnableThreaded turns the cgroup v2 directory dir into a threaded cgroup,
+// making its parent the root of a threaded subtree, so that the threads of a
+// process can be spread over dir and its siblings.
+func EnableThreaded(dir string) error {
+	return WriteFile(dir, "cgroup.type", "threaded")
+}
+
+func writeCgroupID(d *cgroupDir, name string, id int) error {
+	if d.path == "" {
+		return fmt.Errorf("no such directory for %s", name)
 	}
 
-	if pid == -1 {
+	if id == -1 {
 		return nil
 	}
 
-	file, err := OpenFile(dir, CgroupProcesses, os.O_WRONLY)
+	file, err := d.openFile(name, os.O_WRONLY)
 	if err != nil {
-		return fmt.Errorf("failed to write %v to %v: %v", pid, CgroupProcesses, err)
+		return fmt.Errorf("failed to write %v to %v: %v", id, name, err)
 	}
 	defer file.Close()
 
 	for i := 0; i < 5; i++ {
-		_, err = file.WriteString(strconv.Itoa(pid))
+		_, err = file.WriteString(strconv.Itoa(id))
 		if err == nil {
 			return nil
 		}
@@ -303,9 +398,9 @@ func WriteCgroupProc(dir string, pid int) error {
 			continue
 		}
 
-		return fmt.Errorf("failed to write %v to %v: %v", pid, CgroupProcesses, err)
+		return newCgroupError(d.path, name, strconv.Itoa(id), err)
 	}
-	return err
+	return newCgroupError(d.path, name, strconv.Itoa(id), err)
 }
 
 func ConvertCPUSharesToCgroupV2Value(cpuShares uint64) uint64 {
@@ -2,6 +2,7 @@ package cgroupManager
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -90,7 +91,7 @@ func tryDefaultPath(cgroupPath, subsystem string) string {
 
 // https://www.kernel.org/doc/Documentation/cgroup-v1/cgroups.txt
 func FindCgroupMountpoint(cgroupPath, subsystem string) (string, error) {
-	if IsCgroup2UnifiedMode() {
+	if isCgroup2UnifiedModeAt(cgroupPath) {
 		return "", errUnified
 	}
 
@@ -104,7 +105,7 @@ func FindCgroupMountpoint(cgroupPath, subsystem string) (string, error) {
 }
 
 func FindCgroupMountpointAndRoot(cgroupPath, subsystem string) (string, string, error) {
-	if IsCgroup2UnifiedMode() {
+	if isCgroup2UnifiedModeAt(cgroupPath) {
 		return "", "", errUnified
 	}
 
@@ -113,13 +114,12 @@ func FindCgroupMountpointAndRoot(cgroupPath, subsystem string) (string, string,
 		return "", "", NewNotFoundError(subsystem)
 	}
 
-	f, err := os.Open("/proc/self/mountinfo")
+	snap, err := getMountSnapshot()
 	if err != nil {
 		return "", "", err
 	}
-	defer f.Close()
 
-	return findCgroupMountpointAndRootFromReader(f, cgroupPath, subsystem)
+	return findCgroupMountpointAndRootFromReader(bytes.NewReader(snap.mountinfo), cgroupPath, subsystem)
 }
 
 func findCgroupMountpointAndRootFromReader(reader io.Reader, cgroupPath, subsystem string) (string, string, error) {
@@ -150,11 +150,11 @@ func isSubsystemAvailable(subsystem string) bool {
 		panic("don't call isSubsystemAvailable from cgroupv2 code")
 	}
 
-	cgroups, err := ParseCgroupFile("/proc/self/cgroup")
+	snap, err := getMountSnapshot()
 	if err != nil {
 		return false
 	}
-	_, avail := cgroups[subsystem]
+	_, avail := snap.controllers[subsystem]
 	return avail
 }
 
@@ -205,22 +205,16 @@ func getCgroupMountsHelper(ss map[string]bool, mi io.Reader, all bool) ([]Mount,
 }
 
 func getCgroupMountsV1(all bool) ([]Mount, error) {
-	f, err := os.Open("/proc/self/mountinfo")
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
-	allSubsystems, err := ParseCgroupFile("/proc/self/cgroup")
+	snap, err := getMountSnapshot()
 	if err != nil {
 		return nil, err
 	}
 
 	allMap := make(map[string]bool)
-	for s := range allSubsystems {
+	for s := range snap.controllers {
 		allMap[s] = false
 	}
-	return getCgroupMountsHelper(allMap, f, all)
+	return getCgroupMountsHelper(allMap, bytes.NewReader(snap.mountinfo), all)
 }
 
 // GetOwnCgroup returns the relative path to the cgroup docker is running in.
@@ -237,12 +231,18 @@ func GetOwnCgroup(subsystem string) (string, error) {
 }
 
 func GetOwnCgroupPath(subsystem string) (string, error) {
+	return GetOwnCgroupPathAt("", subsystem)
+}
+
+// GetOwnCgroupPathAt is like GetOwnCgroupPath, but only considers the
+// hierarchies mounted under root.
+func GetOwnCgroupPathAt(root, subsystem string) (string, error) {
 	cgroup, err := GetOwnCgroup(subsystem)
 	if err != nil {
 		return "", err
 	}
 
-	return getCgroupPathHelper(subsystem, cgroup)
+	return getCgroupPathHelper(root, subsystem, cgroup)
 }
 
 func GetInitCgroup(subsystem string) (string, error) {
@@ -258,28 +258,27 @@ func GetInitCgroup(subsystem string) (string, error) {
 }
 
 func GetInitCgroupPath(subsystem string) (string, error) {
+	return GetInitCgroupPathAt("", subsystem)
+}
+
+// GetInitCgroupPathAt is like GetInitCgroupPath, but only considers the
+// hierarchies mounted under root.
+func GetInitCgroupPathAt(root, subsystem string) (string, error) {
 	cgroup, err := GetInitCgroup(subsystem)
 	if err != nil {
 		return "", err
 	}
 
-	return getCgroupPathHelper(subsystem, cgroup)
+	return getCgroupPathHelper(root, subsystem, cgroup)
 }
 
-func getCgroupPathHelper(subsystem, cgroup string) (string, error) {
-	mnt, root, err := FindCgroupMountpointAndRoot("", subsystem)
-	if err != nil {
-		return "", err
-	}
-
-	// This is needed for nested containers, because in /proc/self/cgroup we
-	// see paths from host, which don't exist in container.
-	relCgroup, err := filepath.Rel(root, cgroup)
+func getCgroupPathHelper(cgroupPath, subsystem, cgroup string) (string, error) {
+	mnt, root, err := FindCgroupMountpointAndRoot(cgroupPath, subsystem)
 	if err != nil {
 		return "", err
 	}
 
-	return filepath.Join(mnt, relCgroup), nil
+	return mountedCgroupPath(mnt, root, cgroup)
 }
 
 func getControllerPath(subsystem string, cgroups map[string]string) (string, error) {